@@ -0,0 +1,97 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+// Backend identifies the underlying filesystem watcher of a Notifier.
+type Backend uint8
+
+const (
+	// Native is the native watcher of the platform. It is the default backend,
+	// Notifier.Backend never reports it, but the actual backend instead.
+	Native Backend = iota
+
+	// Inotify is the native watcher on Linux.
+	Inotify
+
+	// Fanotify marks whole filesystems and filters their events by watched
+	// paths on Linux. Recursive watchpoints are set up at once, without
+	// watching every directory within them, and never miss directories created
+	// meanwhile.
+	//
+	// Fanotify reports Create, Remove, Write and Rename events only, Move
+	// events are reported as Rename and Create ones. It requires Linux 5.9 or
+	// newer, CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH capabilities, and works on
+	// filesystems, which support file handles.
+	Fanotify
+
+	// FSEvents is the native watcher on Darwin, when built with cgo.
+	FSEvents
+
+	// Kqueue is the native watcher on BSDs, and on Darwin when built without
+	// cgo or with the kqueue tag.
+	Kqueue
+
+	// ReadDirectoryChangesW is the native watcher on Windows.
+	ReadDirectoryChangesW
+
+	// FEN is the native watcher on Solaris and illumos.
+	FEN
+
+	// Polling scans watched paths periodically, see WithPolling. It is
+	// the native watcher on platforms without native notifications.
+	Polling
+)
+
+var backendstr = map[Backend]string{
+	Native:                "notify.Native",
+	Inotify:               "notify.Inotify",
+	Fanotify:              "notify.Fanotify",
+	FSEvents:              "notify.FSEvents",
+	Kqueue:                "notify.Kqueue",
+	ReadDirectoryChangesW: "notify.ReadDirectoryChangesW",
+	FEN:                   "notify.FEN",
+	Polling:               "notify.Polling",
+}
+
+// String implements fmt.Stringer interface.
+func (b Backend) String() string {
+	return backendstr[b]
+}
+
+// WithBackend makes the Notifier use the given backend instead of the native
+// one, e.g. Polling for network mounts or Fanotify for large trees on Linux.
+// If the backend is not available on the platform, or fails to initialize,
+// the Notifier falls back to the native one and logs a warning; the backend
+// which is actually used is reported by Notifier.Backend.
+//
+// Passing Polling is equivalent to WithPolling with the default interval.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// Backend gives the backend used by the Notifier n.
+func (n *Notifier) Backend() Backend {
+	return n.backend
+}
+
+// newBackend creates the watcher of the backend selected by o, falling back to
+// the native one if it is not available.
+func newBackend(o *options, c chan<- EventInfo) (watcher, Backend) {
+	switch b := o.backend; {
+	case b == Polling:
+		return newPoller(c, o.poll), Polling
+	case b == Fanotify:
+		w, err := newFanotify(c)
+		if err == nil {
+			return w, Fanotify
+		}
+		warn("backend unavailable, falling back to the native one", "backend", b, "native", nativeBackend, "err", err)
+	case b != Native && b != nativeBackend:
+		warn("backend unavailable, falling back to the native one", "backend", b, "native", nativeBackend)
+	}
+	return newWatcher(c), nativeBackend
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Debounce coalesces events received from in, so that a burst of events for a
+// single path is sent to the returned channel as a single EventInfo. Its Event
+// is a logical sum of all the events of the burst, while its Sys is the Sys of
+// the most recent one.
+//
+// An event is sent when no other event for its path was received within the
+// quiet period. If events for a path keep coming, they are sent anyway after
+// max elapses since the first event of the burst. Non-positive max means there
+// is no such limit. Bursts, which are due at the same time, are sent in order
+// of their first events.
+//
+// Overflow, Invalidated and Move events with known old path are never
+// coalesced, they are sent right after the pending events for their paths.
+//
+// The returned channel is closed after in gets closed and all pending events
+// are sent. Debounce never drops events, it buffers them until the receiver is
+// ready instead. Closing done makes it discard the events, which were not sent
+// yet, and close the returned channel right away, e.g. when the receiver stops
+// reading. Nil done is never closed.
+//
+// Debounce works with any events, including the platform-specific ones:
+//
+//	c := make(chan notify.EventInfo, 1)
+//	if err := notify.Watch("./...", c, notify.All); err != nil {
+//	    log.Fatal(err)
+//	}
+//	for ei := range notify.Debounce(c, 100*time.Millisecond, time.Second, nil) {
+//	    log.Println("Got event:", ei)
+//	}
+func Debounce(in <-chan EventInfo, quiet, max time.Duration, done <-chan struct{}) <-chan EventInfo {
+	d := &debouncer{
+		in:      in,
+		done:    done,
+		c:       make(chan EventInfo),
+		quiet:   quiet,
+		max:     max,
+		pending: make(map[string]*coalesced),
+	}
+	go d.loop()
+	return d.c
+}
+
+// coalesced is a burst of events for a single path.
+type coalesced struct {
+	e     Event
+	p     string
+	sys   interface{}
+	dir   isDirer   // the most recent event of the burst, which implements it
+	first time.Time // when the first event of the burst was received
+	last  time.Time // when the most recent event of the burst was received
+}
+
+var _ fmt.Stringer = (*coalesced)(nil)
+var _ isDirer = (*coalesced)(nil)
+
+func (e *coalesced) Event() Event     { return e.e }
+func (e *coalesced) Path() string     { return e.p }
+func (e *coalesced) Sys() interface{} { return e.sys }
+
+func (e *coalesced) isDir() (bool, error) {
+	if e.dir == nil {
+		return false, nil
+	}
+	return e.dir.isDir()
+}
+
+// String implements fmt.Stringer interface.
+func (e *coalesced) String() string {
+	return e.Event().String() + `: "` + e.Path() + `"`
+}
+
+// debouncer coalesces events read from in and sends them to c.
+type debouncer struct {
+	in      <-chan EventInfo
+	c       chan EventInfo
+	done    <-chan struct{}
+	quiet   time.Duration
+	max     time.Duration
+	pending map[string]*coalesced // bursts which are still coming
+	order   []*coalesced          // pending bursts, in order of their first events
+	ready   []EventInfo           // events to be sent to c, in order
+}
+
+// due gives the time the burst is to be sent at.
+func (d *debouncer) due(e *coalesced) time.Time {
+	t := e.last.Add(d.quiet)
+	if d.max > 0 {
+		if m := e.first.Add(d.max); m.Before(t) {
+			t = m
+		}
+	}
+	return t
+}
+
+// add records ei as a part of a burst for its path.
+func (d *debouncer) add(ei EventInfo, now time.Time) {
+	if mi, ok := ei.(MoveInfo); ok && mi.OldPath() != "" {
+		d.flush(mi.OldPath())
+		d.flush(mi.Path())
+		d.ready = append(d.ready, ei)
+		return
+	}
+	if e := ei.Event(); e == Overflow || e == Invalidated {
+		d.ready = append(d.ready, ei)
+		return
+	}
+	e, ok := d.pending[ei.Path()]
+	if !ok {
+		e = &coalesced{p: ei.Path(), first: now}
+		d.pending[ei.Path()] = e
+		d.order = append(d.order, e)
+	}
+	e.e |= ei.Event()
+	e.sys = ei.Sys()
+	if dir, ok := ei.(isDirer); ok {
+		e.dir = dir
+	}
+	e.last = now
+}
+
+// flush moves a pending burst for the path, if any, to the ready ones.
+func (d *debouncer) flush(path string) {
+	if e, ok := d.pending[path]; ok {
+		delete(d.pending, path)
+		for i := range d.order {
+			if d.order[i] == e {
+				d.order = append(d.order[:i], d.order[i+1:]...)
+				break
+			}
+		}
+		d.ready = append(d.ready, e)
+	}
+}
+
+// flushall moves all the pending bursts to the ready ones, in order.
+func (d *debouncer) flushall() {
+	for _, e := range d.order {
+		delete(d.pending, e.p)
+		d.ready = append(d.ready, e)
+	}
+	d.order = nil
+}
+
+// flushdue moves all the pending bursts that are due at now to the ready ones,
+// in order, and gives the time the next pending burst is due at.
+func (d *debouncer) flushdue(now time.Time) (next time.Time) {
+	n := 0
+	for _, e := range d.order {
+		due := d.due(e)
+		if !due.After(now) {
+			delete(d.pending, e.p)
+			d.ready = append(d.ready, e)
+			continue
+		}
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+		d.order[n] = e
+		n++
+	}
+	for i := n; i < len(d.order); i++ {
+		d.order[i] = nil
+	}
+	d.order = d.order[:n]
+	return next
+}
+
+func (d *debouncer) loop() {
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+		at      time.Time // when timer fires
+	)
+	for {
+		var (
+			c  chan<- EventInfo
+			ei EventInfo
+		)
+		if len(d.ready) != 0 {
+			c, ei = d.c, d.ready[0]
+		}
+		select {
+		case e, ok := <-d.in:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				d.flushall()
+				d.close()
+				return
+			}
+			d.add(e, time.Now())
+		case c <- ei:
+			d.ready[0] = nil
+			d.ready = d.ready[1:]
+		case <-d.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			close(d.c)
+			return
+		case <-timeout:
+			timer, timeout, at = nil, nil, time.Time{}
+		}
+		next := d.flushdue(time.Now())
+		if !next.Equal(at) {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer, timeout, at = nil, nil, next
+			if !next.IsZero() {
+				timer = time.NewTimer(time.Until(next))
+				timeout = timer.C
+			}
+		}
+	}
+}
+
+// close sends the ready events and closes c. It gives up sending once done
+// gets closed.
+func (d *debouncer) close() {
+	defer close(d.c)
+	for _, ei := range d.ready {
+		select {
+		case d.c <- ei:
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, c <-chan EventInfo) EventInfo {
+	t.Helper()
+	select {
+	case ei, ok := <-c:
+		if !ok {
+			t.Fatal("channel closed unexpectedly")
+		}
+		return ei
+	case <-time.After(timeout()):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestDebounce(t *testing.T) {
+	in := make(chan EventInfo)
+	c := Debounce(in, 20*time.Millisecond, 0, nil)
+
+	in <- &synthetic{e: Create, p: "/a"}
+	in <- &synthetic{e: Write, p: "/b"}
+	in <- &synthetic{e: Write, p: "/a", sys: 1}
+	in <- &synthetic{e: Remove, p: "/a", sys: 2}
+
+	got := map[string]EventInfo{}
+	for i := 0; i < 2; i++ {
+		ei := receive(t, c)
+		got[ei.Path()] = ei
+	}
+	if ei := got["/a"]; ei == nil || ei.Event() != Create|Write|Remove || ei.Sys() != 2 {
+		t.Fatalf("want Create|Write|Remove on /a with sys=2; got %v", ei)
+	}
+	if ei := got["/b"]; ei == nil || ei.Event() != Write {
+		t.Fatalf("want Write on /b; got %v", ei)
+	}
+
+	in <- &synthetic{e: Write, p: "/c"}
+	close(in)
+	if ei := receive(t, c); ei.Path() != "/c" {
+		t.Fatalf("want pending event to be flushed on close; got %v", ei)
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("want channel to be closed")
+	}
+}
+
+func TestDebounceOrder(t *testing.T) {
+	in := make(chan EventInfo)
+	c := Debounce(in, 20*time.Millisecond, 0, nil)
+	defer close(in)
+
+	// Bursts are sent in order of their first events, even if they are due
+	// at the same time.
+	var paths []string
+	for i := 0; i < 20; i++ {
+		paths = append(paths, fmt.Sprintf("/%d", i))
+	}
+	for _, p := range paths {
+		in <- &synthetic{e: Create, p: p}
+	}
+	for _, p := range paths {
+		in <- &synthetic{e: Write, p: p}
+	}
+	for _, p := range paths {
+		if ei := receive(t, c); ei.Path() != p {
+			t.Fatalf("want event on %s; got %v", p, ei)
+		}
+	}
+}
+
+func TestDebounceMax(t *testing.T) {
+	in := make(chan EventInfo)
+	c := Debounce(in, time.Hour, 50*time.Millisecond, nil)
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+		close(in)
+	}()
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case in <- &synthetic{e: Write, p: "/a"}:
+			case <-done:
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if ei := receive(t, c); ei.Path() != "/a" || ei.Event() != Write {
+		t.Fatalf("want Write on /a; got %v", ei)
+	}
+}
+
+func TestDebouncePassThrough(t *testing.T) {
+	in := make(chan EventInfo)
+	c := Debounce(in, time.Hour, 0, nil)
+
+	in <- &synthetic{e: Write, p: "/a"}
+	in <- &synthetic{e: Write, p: "/c"}
+	in <- &moved{e: Move, p: "/b", old: "/a"}
+	in <- &synthetic{e: Overflow, p: "/"}
+
+	want := []struct {
+		e Event
+		p string
+	}{
+		{Write, "/a"},
+		{Move, "/b"},
+		{Overflow, "/"},
+	}
+	for i, want := range want {
+		if ei := receive(t, c); ei.Event() != want.e || ei.Path() != want.p {
+			t.Fatalf("want %v on %s; got %v (i=%d)", want.e, want.p, ei, i)
+		}
+	}
+	close(in)
+	if ei := receive(t, c); ei.Path() != "/c" {
+		t.Fatalf("want Write on /c; got %v", ei)
+	}
+}
+
+func TestDebounceDone(t *testing.T) {
+	in := make(chan EventInfo)
+	done := make(chan struct{})
+	c := Debounce(in, time.Hour, 0, done)
+
+	in <- &synthetic{e: Create, p: "/a", d: true}
+	in <- &synthetic{e: Write, p: "/b"}
+	close(in)
+	ei := receive(t, c)
+	if isdir, err := ei.(isDirer).isDir(); ei.Path() != "/a" || !isdir || err != nil {
+		t.Fatalf("want directory event on /a; got %v (isdir=%v, err=%v)", ei, isdir, err)
+	}
+	// The receiver stops reading, the pending event on /b is discarded.
+	close(done)
+	select {
+	case ei, ok := <-c:
+		if ok {
+			// The event could have been sent before done was noticed.
+			if _, ok = <-c; ok {
+				t.Fatalf("want channel to be closed; got %v", ei)
+			}
+		}
+	case <-time.After(timeout()):
+		t.Fatal("want channel to be closed after done is closed")
+	}
+}
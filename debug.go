@@ -5,49 +5,61 @@
 package notify
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
-	"runtime"
-	"strings"
+	"sync/atomic"
 )
 
-var dbgprint func(...interface{})
-
-var dbgprintf func(string, ...interface{})
-
-var dbgcallstack func(max int) []string
+// logger is the logger used by notify, nil disables logging.
+var logger atomic.Pointer[slog.Logger]
 
 func init() {
 	if _, ok := os.LookupEnv("NOTIFY_DEBUG"); ok || debugTag {
-		log.SetOutput(os.Stdout)
-		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
-		dbgprint = func(v ...interface{}) {
-			v = append([]interface{}{"[D] "}, v...)
-			log.Println(v...)
-		}
-		dbgprintf = func(format string, v ...interface{}) {
-			format = "[D] " + format
-			log.Printf(format, v...)
-		}
-		dbgcallstack = func(max int) []string {
-			pc, stack := make([]uintptr, max), make([]string, 0, max)
-			runtime.Callers(2, pc)
-			for _, pc := range pc {
-				if f := runtime.FuncForPC(pc); f != nil {
-					fname := f.Name()
-					idx := strings.LastIndex(fname, string(os.PathSeparator))
-					if idx != -1 {
-						stack = append(stack, fname[idx+1:])
-					} else {
-						stack = append(stack, fname)
-					}
-				}
-			}
-			return stack
-		}
-		return
+		logger.Store(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		})))
+	}
+}
+
+// SetLogger sets the logger used by notify, nil disables logging, which is the
+// default. Records are logged with the following levels:
+//
+//   - Debug for tracing the internals, e.g. dispatching of every event,
+//   - Warn for dropped events and errors, which happened asynchronously.
+//
+// Records carry attributes describing their context, like "path", "event",
+// "wd" (inotify watch descriptor), "chan" (an identifier of a user channel)
+// and "err".
+//
+// Setting NOTIFY_DEBUG environment variable, or building with the debug tag,
+// makes notify log records of all levels to stdout by default.
+//
+// SetLogger is safe to call at any time, from multiple goroutines.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// logAt logs msg with the given attributes, it is a nop if logging is disabled
+// or the level is not enabled.
+func logAt(level slog.Level, msg string, args ...interface{}) {
+	if l := logger.Load(); l != nil && l.Enabled(context.Background(), level) {
+		l.Log(context.Background(), level, msg, args...)
 	}
-	dbgprint = func(v ...interface{}) {}
-	dbgprintf = func(format string, v ...interface{}) {}
-	dbgcallstack = func(max int) []string { return nil }
+}
+
+// debug logs msg with the given attributes at the Debug level.
+func debug(msg string, args ...interface{}) {
+	logAt(slog.LevelDebug, msg, args...)
+}
+
+// warn logs msg with the given attributes at the Warn level.
+func warn(msg string, args ...interface{}) {
+	logAt(slog.LevelWarn, msg, args...)
+}
+
+// chanattr gives an attribute identifying the user channel c.
+func chanattr(c chan<- EventInfo) slog.Attr {
+	return slog.String("chan", fmt.Sprintf("%p", c))
 }
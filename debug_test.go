@@ -0,0 +1,46 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	prev := logger.Load()
+	defer SetLogger(prev)
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.Send(delivery{c: c, ei: &synthetic{e: Create, p: "/tmp/file"}})
+	debug("not logged")
+
+	out := buf.String()
+	for _, want := range []string{"level=WARN", "event=notify.Create", "path=/tmp/file", "chan=0x"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in %q", want, out)
+		}
+	}
+	if strings.Contains(out, "not logged") {
+		t.Errorf("want debug records to be discarded; got %q", out)
+	}
+
+	SetLogger(nil)
+	buf.Reset()
+	warn("not logged")
+	if buf.Len() != 0 {
+		t.Errorf("want nothing to be logged; got %q", buf.String())
+	}
+}
@@ -0,0 +1,554 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Delivery describes what happens to an event, which is to be sent to a channel
+// whose receiver is not ready to receive it.
+type Delivery uint8
+
+const (
+	// DropNewest drops the event, which is being sent. It is the default
+	// delivery policy.
+	DropNewest Delivery = iota
+
+	// DropOldest keeps the most recent events in an internal ring buffer,
+	// dropping the oldest ones when the buffer is full.
+	DropOldest
+
+	// Block waits until the receiver is ready, optionally giving up after
+	// a timeout.
+	Block
+
+	// Unbounded queues the events in an internal queue, which grows without
+	// any limit. No events are ever dropped.
+	Unbounded
+)
+
+var deliverystr = map[Delivery]string{
+	DropNewest: "notify.DropNewest",
+	DropOldest: "notify.DropOldest",
+	Block:      "notify.Block",
+	Unbounded:  "notify.Unbounded",
+}
+
+// String implements fmt.Stringer interface.
+func (d Delivery) String() string {
+	return deliverystr[d]
+}
+
+// WatchOption configures a single Watch call.
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	delivery  *deliveryOptions // nil means the default one
+	include   []string         // glob patterns of paths to include
+	exclude   []string         // glob patterns of paths to exclude
+	gitignore bool             // whether to honour ignore files
+	closing   bool             // whether to close the channel once stopped
+	rollback  bool             // whether recursive watch is all-or-nothing
+	persist   bool             // whether to watch the path again once it is back
+	missing   bool             // whether the path may not exist yet
+	byname    bool             // whether a file is watched by its name
+}
+
+type deliveryOptions struct {
+	policy  Delivery
+	size    int           // size of a ring buffer for DropOldest
+	timeout time.Duration // timeout for Block, 0 means no timeout
+}
+
+func newWatchOptions(opts []WatchOption) *watchOptions {
+	o := &watchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// DeliverDropNewest sets the DropNewest delivery policy for the channel.
+func DeliverDropNewest() WatchOption {
+	return func(o *watchOptions) {
+		o.delivery = &deliveryOptions{policy: DropNewest}
+	}
+}
+
+// DeliverDropOldest sets the DropOldest delivery policy for the channel with
+// a ring buffer, which holds up to size events. Non-positive size defaults
+// to 128.
+func DeliverDropOldest(size int) WatchOption {
+	return func(o *watchOptions) {
+		if size <= 0 {
+			size = buffer
+		}
+		o.delivery = &deliveryOptions{policy: DropOldest, size: size}
+	}
+}
+
+// DeliverBlock sets the Block delivery policy for the channel. Non-positive
+// timeout means sending waits as long as needed.
+//
+// A blocked send never delays sending the event to channels with other
+// delivery policies, it may delay sending it to other Block channels though.
+//
+// By default every event is dispatched by its own goroutine, so each event
+// waiting for the receiver of a Block channel parks a goroutine, with no limit
+// on their number. Block should be used only with a Notifier created with the
+// WithOrdered option, which bounds the number of waiting sends by the number
+// of its workers.
+func DeliverBlock(timeout time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		if timeout < 0 {
+			timeout = 0
+		}
+		o.delivery = &deliveryOptions{policy: Block, timeout: timeout}
+	}
+}
+
+// DeliverUnbounded sets the Unbounded delivery policy for the channel.
+func DeliverUnbounded() WatchOption {
+	return func(o *watchOptions) {
+		o.delivery = &deliveryOptions{policy: Unbounded}
+	}
+}
+
+// CloseOnStop makes notify close the channel once it has no watchpoints left,
+// that is after it is stopped, after its last watchpoint is removed with
+// Unwatch or Subscription.Close, or after the Notifier is closed. It allows for
+// ranging over the channel:
+//
+//	c := make(chan notify.EventInfo, 1)
+//	if err := notify.WatchWith("./...", c, notify.All, notify.CloseOnStop()); err != nil {
+//	    log.Fatal(err)
+//	}
+//	go func() {
+//	    for ei := range c {
+//	        log.Println("Got event:", ei)
+//	    }
+//	    log.Println("Stopped")
+//	}()
+//
+// Like the delivery policy, it is a property of the channel. Once set by any
+// WatchWith call, it applies to all watchpoints of the channel. A closed
+// channel must not be used with notify anymore.
+func CloseOnStop() WatchOption {
+	return func(o *watchOptions) {
+		o.closing = true
+	}
+}
+
+// sink sends events to a single user channel according to its delivery policy.
+type sink struct {
+	c       chan<- EventInfo
+	o       deliveryOptions
+	dropped atomic.Uint64 // number of dropped events
+	total   *counts       // counts of all sinks
+	done    chan struct{} // closed when sink is stopped
+	closing bool          // whether to close c once stopped
+	// rw is held for reading while an event is being sent and for writing
+	// while the sink is being stopped, so no event is sent after stop returns.
+	rw      sync.RWMutex
+	stopped bool         // protected by rw
+	smu     sync.RWMutex // protects closing, scopes and scoped
+	scopes  scopes       // watches registered for c
+	scoped  bool         // whether any watch was registered for c
+	// Following fields are used by DropOldest and Unbounded policies only,
+	// for which events are queued and sent by a separate goroutine.
+	mu     sync.Mutex    // protects queue
+	queue  []EventInfo   // pending events
+	wake   chan struct{} // signals the pump about a new event
+	pumped chan struct{} // closed when the pump returns
+}
+
+func newSink(c chan<- EventInfo, o deliveryOptions, total *counts) *sink {
+	s := &sink{
+		c:     c,
+		o:     o,
+		total: total,
+		done:  make(chan struct{}),
+	}
+	if s.queued() {
+		s.wake = make(chan struct{}, 1)
+		s.pumped = make(chan struct{})
+		go s.pump()
+	}
+	return s
+}
+
+func (s *sink) queued() bool {
+	return s.o.policy == DropOldest || s.o.policy == Unbounded
+}
+
+// send delivers ei according to the delivery policy. It may block only for
+// the Block policy.
+func (s *sink) send(ei EventInfo) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	if s.stopped {
+		return
+	}
+	switch s.o.policy {
+	case Block:
+		var timeout <-chan time.Time
+		if s.o.timeout > 0 {
+			t := time.NewTimer(s.o.timeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case s.c <- ei:
+			s.sent()
+		case <-s.done:
+		case <-timeout:
+			s.drop(ei)
+		}
+	case DropOldest, Unbounded:
+		s.mu.Lock()
+		s.queue = append(s.queue, ei)
+		if s.o.policy == DropOldest && len(s.queue) > s.o.size {
+			s.drop(s.queue[0])
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	default:
+		select {
+		case s.c <- ei:
+			s.sent()
+		default: // Drop event if receiver is too slow
+			s.drop(ei)
+		}
+	}
+}
+
+// accepts reports whether ei passes the filters of the watches registered for
+// the user channel. Overflow and Invalidated events are always accepted, Move
+// events are accepted if either of their paths is.
+func (s *sink) accepts(ei EventInfo) bool {
+	if e := ei.Event(); e == Overflow || e == Invalidated {
+		return true
+	}
+	s.smu.RLock()
+	defer s.smu.RUnlock()
+	if !s.scopes.filtered() {
+		return true
+	}
+	var isdir bool
+	if d, ok := ei.(isDirer); ok {
+		isdir, _ = d.isDir()
+	}
+	if mi, ok := ei.(MoveInfo); ok && mi.OldPath() != "" && s.scopes.accepts(mi.OldPath(), isdir) {
+		return true
+	}
+	return s.scopes.accepts(ei.Path(), isdir)
+}
+
+// pump sends queued events to the user channel until the sink gets stopped.
+func (s *sink) pump() {
+	defer close(s.pumped)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		ei := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.c <- ei:
+			s.sent()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *sink) sent() {
+	s.total.sent.Add(1)
+}
+
+func (s *sink) drop(ei EventInfo) {
+	s.dropped.Add(1)
+	s.total.dropped.Add(1)
+	warn("dropped event: receiver too slow", "event", ei.Event(), "path", ei.Path(), chanattr(s.c))
+}
+
+// stop stops sending events to the user channel. It waits for the events that
+// are being sent to be either delivered or given up, and closes the channel
+// if requested. No events are sent to the channel after stop returns.
+func (s *sink) stop() {
+	close(s.done)
+	s.rw.Lock()
+	s.stopped = true
+	s.rw.Unlock()
+	if s.queued() {
+		<-s.pumped
+	}
+	s.smu.RLock()
+	closing := s.closing && s.scoped
+	s.smu.RUnlock()
+	if closing {
+		close(s.c)
+	}
+}
+
+// counts are numbers of events sent and dropped by sinks.
+type counts struct {
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// sinks maps user channels to their sinks.
+type sinks struct {
+	total    counts
+	mu       sync.RWMutex // protects m and internal
+	m        map[chan<- EventInfo]*sink
+	internal map[chan<- EventInfo]struct{} // channels used by notify itself
+}
+
+func newSinks() *sinks {
+	return &sinks{
+		m:        make(map[chan<- EventInfo]*sink),
+		internal: make(map[chan<- EventInfo]struct{}),
+	}
+}
+
+// Internal marks c as a channel used by notify itself. Watchpoints of such
+// channels are not reported as user ones, even if c is registered with a sink.
+func (s *sinks) Internal(c chan<- EventInfo) {
+	s.mu.Lock()
+	s.internal[c] = struct{}{}
+	s.mu.Unlock()
+}
+
+// IsInternal reports whether c is a channel used by notify itself.
+func (s *sinks) IsInternal(c chan<- EventInfo) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.internal[c]
+	return ok
+}
+
+// Add registers a sink for c configured with o, if c has none, and reports
+// whether it was created. It fails if c is already registered with a different
+// delivery policy. Nil o is treated as a default configuration.
+func (s *sinks) Add(c chan<- EventInfo, o *watchOptions) (bool, error) {
+	var do deliveryOptions
+	if o != nil && o.delivery != nil {
+		do = *o.delivery
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sk, ok := s.m[c]
+	if ok && o != nil && o.delivery != nil && sk.o != do {
+		return false, ErrDelivery
+	}
+	if !ok {
+		sk = newSink(c, do, &s.total)
+		s.m[c] = sk
+	}
+	if o != nil && o.closing {
+		sk.smu.Lock()
+		sk.closing = true
+		sk.smu.Unlock()
+	}
+	return !ok, nil
+}
+
+// Del stops and unregisters a sink of c. When Del returns, no more events are
+// sent to c.
+func (s *sinks) Del(c chan<- EventInfo) {
+	s.mu.Lock()
+	sk, ok := s.m[c]
+	delete(s.m, c)
+	s.mu.Unlock()
+	if ok {
+		sk.stop()
+	}
+}
+
+// Scope registers the watch s for c, replacing the previous watch on the same
+// path. It is a nop if c has no sink.
+func (s *sinks) Scope(c chan<- EventInfo, sc scope) {
+	s.mu.RLock()
+	sk, ok := s.m[c]
+	s.mu.RUnlock()
+	if ok {
+		sk.smu.Lock()
+		sk.scopes = sk.scopes.set(sc)
+		sk.scoped = true
+		sk.smu.Unlock()
+	}
+}
+
+// Unscope removes the events from the watch of the given kind on the path for
+// c and reports whether c has any watches left.
+func (s *sinks) Unscope(c chan<- EventInfo, path string, isrec bool, events Event) bool {
+	s.mu.RLock()
+	sk, ok := s.m[c]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	sk.smu.Lock()
+	defer sk.smu.Unlock()
+	sk.scopes = sk.scopes.del(path, isrec, events)
+	return len(sk.scopes) != 0
+}
+
+// Watching gives the watches on the path, by the channels they are registered
+// for.
+func (s *sinks) Watching(path string) map[chan<- EventInfo]scopes {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[chan<- EventInfo]scopes)
+	for c, sk := range s.m {
+		sk.smu.RLock()
+		for _, sc := range sk.scopes {
+			if sc.watched() == path {
+				m[c] = append(m[c], sc)
+			}
+		}
+		sk.smu.RUnlock()
+	}
+	return m
+}
+
+// Scopes gives a copy of the watches registered for c.
+func (s *sinks) Scopes(c chan<- EventInfo) scopes {
+	s.mu.RLock()
+	sk, ok := s.m[c]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	sk.smu.RLock()
+	defer sk.smu.RUnlock()
+	return append(scopes(nil), sk.scopes...)
+}
+
+// Invalidate drops cached rules of ignore files found in the directory for all
+// watches which honour them.
+func (s *sinks) Invalidate(dir string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sk := range s.m {
+		sk.smu.RLock()
+		for _, sc := range sk.scopes {
+			if sc.f != nil && sc.f.ign != nil {
+				sc.f.ign.invalidate(dir)
+			}
+		}
+		sk.smu.RUnlock()
+	}
+}
+
+// Close stops all the sinks.
+func (s *sinks) Close() {
+	s.mu.Lock()
+	m := s.m
+	s.m = make(map[chan<- EventInfo]*sink)
+	s.mu.Unlock()
+	for _, sk := range m {
+		sk.stop()
+	}
+}
+
+// Send sends ei to c. Internal channels have no sinks, they use the default
+// delivery policy. Events for user channels with no sink, which were stopped
+// in the meantime, are discarded.
+func (s *sinks) Send(d delivery) {
+	if d.internal {
+		select {
+		case d.c <- d.ei:
+		default: // Drop event if receiver is too slow
+			s.total.dropped.Add(1)
+			debug("dropped internal event: receiver too slow", "event", d.ei.Event(), "path", d.ei.Path())
+		}
+		return
+	}
+	s.mu.RLock()
+	sk, ok := s.m[d.c]
+	s.mu.RUnlock()
+	if ok && sk.accepts(d.ei) {
+		sk.send(d.ei)
+	}
+}
+
+// Delivery gives the delivery policy of c.
+func (s *sinks) Delivery(c chan<- EventInfo) Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sk, ok := s.m[c]; ok {
+		return sk.o.policy
+	}
+	return DropNewest
+}
+
+// Stats gives the number of registered user channels and the total numbers of
+// sent and dropped events.
+func (s *sinks) Stats() (channels int, sent, dropped uint64) {
+	s.mu.RLock()
+	for c := range s.m {
+		if _, ok := s.internal[c]; !ok {
+			channels++
+		}
+	}
+	s.mu.RUnlock()
+	return channels, s.total.sent.Load(), s.total.dropped.Load()
+}
+
+// Dropped gives the number of events dropped for c.
+func (s *sinks) Dropped(c chan<- EventInfo) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sk, ok := s.m[c]; ok {
+		return sk.dropped.Load()
+	}
+	return 0
+}
+
+// delivery is a single event that is to be sent to a user channel.
+type delivery struct {
+	c        chan<- EventInfo
+	ei       EventInfo
+	internal bool // whether c is an internal channel
+}
+
+// deliveries is a list of events collected while dispatching, which are sent
+// after the tree is unlocked.
+type deliveries []delivery
+
+// Send sends all the events using given sinks. Events which may block are
+// sent last.
+func (d deliveries) Send(s *sinks) {
+	var block deliveries
+	for _, d := range d {
+		if !d.internal && s.Delivery(d.c) == Block {
+			block = append(block, d)
+			continue
+		}
+		s.Send(d)
+	}
+	for _, d := range block {
+		s.Send(d)
+	}
+}
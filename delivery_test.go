@@ -0,0 +1,182 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testSinkEvents(n int) []EventInfo {
+	ei := make([]EventInfo, n)
+	for i := range ei {
+		ei[i] = &synthetic{e: Create, p: fmt.Sprintf("/tmp/%d", i)}
+	}
+	return ei
+}
+
+func TestSinkDropNewest(t *testing.T) {
+	c := make(chan EventInfo, 2)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	evs := testSinkEvents(5)
+	for _, ei := range evs {
+		s.Send(delivery{c: c, ei: ei})
+	}
+	if n := s.Dropped(c); n != 3 {
+		t.Fatalf("want dropped=3; got %d", n)
+	}
+	for i := 0; i < 2; i++ {
+		if ei := <-c; ei != evs[i] {
+			t.Fatalf("want ei=%v; got %v (i=%d)", evs[i], ei, i)
+		}
+	}
+}
+
+func TestSinkDropOldest(t *testing.T) {
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverDropOldest(2)})); err != nil {
+		t.Fatal(err)
+	}
+	evs := testSinkEvents(10)
+	for _, ei := range evs {
+		s.Send(delivery{c: c, ei: ei})
+	}
+	// The pump may have taken the first event before the queue was trimmed.
+	var got []EventInfo
+	for len(got) == 0 || got[len(got)-1] != evs[len(evs)-1] {
+		select {
+		case ei := <-c:
+			got = append(got, ei)
+		case <-time.After(timeout()):
+			t.Fatalf("timed out, received %v", got)
+		}
+	}
+	if n := uint64(len(got)) + s.Dropped(c); n != uint64(len(evs)) {
+		t.Fatalf("want received+dropped=%d; got %d", len(evs), n)
+	}
+	if len(got) > 3 {
+		t.Fatalf("want at most 3 events; got %v", got)
+	}
+}
+
+func TestSinkUnbounded(t *testing.T) {
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverUnbounded()})); err != nil {
+		t.Fatal(err)
+	}
+	evs := testSinkEvents(256)
+	for _, ei := range evs {
+		s.Send(delivery{c: c, ei: ei})
+	}
+	for i := range evs {
+		select {
+		case ei := <-c:
+			if ei != evs[i] {
+				t.Fatalf("want ei=%v; got %v (i=%d)", evs[i], ei, i)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out (i=%d)", i)
+		}
+	}
+	if n := s.Dropped(c); n != 0 {
+		t.Fatalf("want dropped=0; got %d", n)
+	}
+}
+
+func TestSinkBlock(t *testing.T) {
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverBlock(10 * time.Millisecond)})); err != nil {
+		t.Fatal(err)
+	}
+	evs := testSinkEvents(2)
+	s.Send(delivery{c: c, ei: evs[0]})
+	if n := s.Dropped(c); n != 1 {
+		t.Fatalf("want dropped=1; got %d", n)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Send(delivery{c: c, ei: evs[1]})
+		close(done)
+	}()
+	if ei := <-c; ei != evs[1] {
+		t.Fatalf("want ei=%v; got %v", evs[1], ei)
+	}
+	<-done
+}
+
+func TestSinksAdd(t *testing.T) {
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if created, err := s.Add(c, newWatchOptions([]WatchOption{DeliverUnbounded()})); err != nil || !created {
+		t.Fatalf("want created=true, err=nil; got %t, %v", created, err)
+	}
+	if created, err := s.Add(c, nil); err != nil || created {
+		t.Fatalf("want created=false, err=nil; got %t, %v", created, err)
+	}
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverBlock(0)})); err != ErrDelivery {
+		t.Fatalf("want err=%v; got %v", ErrDelivery, err)
+	}
+	s.Del(c)
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverBlock(0)})); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Delivery(c); d != Block {
+		t.Fatalf("want delivery=%v; got %v", Block, d)
+	}
+}
+
+func TestSinksDel(t *testing.T) {
+	c := make(chan EventInfo)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{DeliverBlock(0), CloseOnStop()})); err != nil {
+		t.Fatal(err)
+	}
+	s.Scope(c, scope{path: "/tmp", events: Create})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		s.Send(delivery{c: c, ei: testSinkEvents(1)[0]})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Del(c)
+	select {
+	case <-sent:
+	default:
+		t.Fatal("want pending send to be given up when Del returns")
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("want channel to be closed")
+	}
+	// Stopped channel receives no more events.
+	s.Send(delivery{c: c, ei: testSinkEvents(1)[0]})
+}
+
+func TestSinksDelNotWatched(t *testing.T) {
+	c := make(chan EventInfo, 1)
+	s := newSinks()
+	defer s.Close()
+	if _, err := s.Add(c, newWatchOptions([]WatchOption{CloseOnStop()})); err != nil {
+		t.Fatal(err)
+	}
+	s.Del(c)
+	select {
+	case c <- nil:
+	default:
+		t.Fatal("want channel which was never watched to be left open")
+	}
+}
@@ -7,7 +7,8 @@
 // Notify is a high-level abstraction over filesystem watchers like inotify,
 // kqueue, FSEvents, FEN or ReadDirectoryChangesW. Watcher implementations are
 // split into two groups: ones that natively support recursive notifications
-// (FSEvents and ReadDirectoryChangesW) and ones that do not (inotify, kqueue, FEN).
+// (FSEvents, ReadDirectoryChangesW and inotify, which follows new directories
+// by itself) and ones that do not (kqueue, FEN).
 // For more details see watcher and recursiveWatcher interfaces in watcher.go
 // source file.
 //
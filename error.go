@@ -0,0 +1,159 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Errors returned by notify, wrapped in *WatchError. They can be tested for
+// with errors.Is:
+//
+//	if err := notify.Unwatch("/tmp", c); errors.Is(err, notify.ErrNotWatched) {
+//	    log.Println("/tmp was not watched")
+//	}
+//
+// Errors of the underlying system calls are wrapped as well, e.g. running out
+// of inotify watches can be tested for with errors.Is(err, syscall.ENOSPC),
+// while missing permissions with errors.Is(err, fs.ErrPermission).
+var (
+	// ErrAlreadyWatched is returned by a watcher when the path is already
+	// watched.
+	ErrAlreadyWatched = errors.New("notify: path is already watched")
+
+	// ErrNotWatched is returned when the path is not watched, e.g. by Unwatch.
+	ErrNotWatched = errors.New("notify: path is not being watched")
+
+	// ErrInvalidEventSet is returned when the event set does not match the
+	// one the path is watched with.
+	ErrInvalidEventSet = errors.New("notify: invalid event set provided")
+
+	// ErrUnknownEvent is returned when the event set contains events, which
+	// are not supported by the platform.
+	ErrUnknownEvent = errors.New("notify: unknown event")
+
+	// ErrClosed is returned when the Notifier was closed.
+	ErrClosed = errors.New("notify: notifier is closed")
+
+	// ErrDelivery is returned when the channel is already registered with
+	// a different delivery policy.
+	ErrDelivery = errors.New("notify: channel is already registered with different delivery policy")
+
+	// ErrWatchLimit is returned when the system limit of watches was reached.
+	// The error describing the limit is of *WatchLimitError type.
+	ErrWatchLimit = errors.New("notify: watch limit reached")
+)
+
+// WatchLimitError records a watch request, which failed because the system
+// limit of watches was reached, e.g. fs.inotify.max_user_watches on Linux.
+// It matches ErrWatchLimit:
+//
+//	var lerr *notify.WatchLimitError
+//	if errors.As(err, &lerr) {
+//	    log.Printf("need %d more watches", lerr.Held+lerr.Needed-lerr.Max)
+//	}
+type WatchLimitError struct {
+	Max    int   // the limit of watches, -1 if unknown
+	Held   int   // number of watches held by the process, -1 if unknown
+	Needed int   // number of watches the request needed
+	Err    error // underlying error
+}
+
+// Error implements the error interface.
+func (e *WatchLimitError) Error() string {
+	return fmt.Sprintf("notify: watch limit reached (max=%d, held=%d, needed=%d): %v",
+		e.Max, e.Held, e.Needed, e.Err)
+}
+
+// Is reports whether the target is ErrWatchLimit.
+func (e *WatchLimitError) Is(target error) bool {
+	return target == ErrWatchLimit
+}
+
+// Unwrap gives the underlying error.
+func (e *WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+// WatchError records an error together with the operation and the path that
+// caused it.
+type WatchError struct {
+	Op   string // operation that failed, e.g. "watch" or "unwatch"
+	Path string // path the operation was performed on, can be empty
+	Err  error  // underlying error
+}
+
+// Error implements the error interface.
+func (e *WatchError) Error() string {
+	msg := strings.TrimPrefix(e.Err.Error(), "notify: ")
+	if e.Path == "" {
+		return "notify: " + e.Op + ": " + msg
+	}
+	return "notify: " + e.Op + " " + e.Path + ": " + msg
+}
+
+// Unwrap gives the underlying error.
+func (e *WatchError) Unwrap() error {
+	return e.Err
+}
+
+// watchError wraps err in *WatchError, unless it already is one. It gives nil
+// for nil err.
+func watchError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*WatchError); ok {
+		return err
+	}
+	return &WatchError{Op: op, Path: path, Err: err}
+}
+
+// errorsChan delivers errors, which happened asynchronously, to the user.
+// An error is dropped if the user does not keep up with receiving them.
+type errorsChan struct {
+	mu     sync.RWMutex // protects closed
+	c      chan error
+	closed bool
+	sub    func(error) // receives every reported error as well, may be nil
+}
+
+func newErrorsChan(n int) *errorsChan {
+	return &errorsChan{c: make(chan error, n)}
+}
+
+// report sends err to the user. It is safe to call report on nil errorsChan,
+// in which case err is only logged.
+func (e *errorsChan) report(err error) {
+	warn("async error", "err", err)
+	if e == nil {
+		return
+	}
+	if e.sub != nil {
+		e.sub(err)
+	}
+	e.mu.RLock()
+	if !e.closed {
+		select {
+		case e.c <- err:
+		default: // Drop error if receiver is too slow
+			warn("dropped error: receiver too slow", "err", err)
+		}
+	}
+	e.mu.RUnlock()
+}
+
+// close closes the user channel. Errors reported afterwards are discarded.
+func (e *errorsChan) close() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.c)
+	}
+	e.mu.Unlock()
+}
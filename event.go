@@ -31,6 +31,44 @@ const (
 	All = Create | Remove | Write | Rename
 )
 
+// Overflow is reported when the underlying watcher lost track of filesystem
+// events, e.g. when the inotify queue was overflowed. Events that happened
+// around the time of the overflow may have never been reported.
+//
+// Overflow is sent to every channel registered for watchpoints affected by the
+// overflow, regardless of the event set the channel was registered with; it
+// is not needed to pass it to Watch. The Path of an Overflow event is the path
+// of the watchpoint the channel was registered for.
+const Overflow = overflow
+
+// Move is reported when a file or directory was moved, and both rename events
+// describing the move were observed within watched directories. Events of
+// Move type implement the MoveInfo interface.
+//
+// Move is not a part of All and needs to be passed to Watch explicitly. When
+// only one end of the move was observed, the channels listening for Move
+// receive Remove (moved out) or Create (moved in) event instead, which still
+// implements MoveInfo with an empty OldPath.
+//
+// Move is currently reported under Linux (inotify) only. On the other
+// platforms watching for Move is the same as watching for Create, Remove
+// and Rename events.
+const Move = move
+
+// Invalidated is reported when the path of a watchpoint was removed, moved
+// away or unmounted, so the watchpoint does not receive any more events. The
+// watchpoint is removed then, unless it was set up with the Persistent option.
+// The channel stays registered until it is stopped, even if it has no other
+// watchpoints left.
+//
+// Like Overflow, Invalidated is sent to every channel registered for the
+// watchpoint regardless of its event set, and it is not needed to pass it to
+// Watch. The Path of an Invalidated event is the path of the watchpoint.
+//
+// Invalidated is currently reported under Linux (inotify) and by the polling
+// watcher only.
+const Invalidated = invalidated
+
 const internal = recursive | omit
 
 // String implements fmt.Stringer interface.
@@ -89,6 +127,8 @@ func (e Event) String() string {
 //
 //	http://man7.org/linux/man-pages/man7/inotify.7.html
 //
+// Under Linux with the fanotify watcher (Fanotify backend) Sys() always returns nil.
+//
 // Under Darwin, DragonFlyBSD, FreeBSD, NetBSD, OpenBSD (kqueue) Sys() always
 // returns a non-nil *notify.Kevent value, which is defined as:
 //
@@ -111,6 +151,14 @@ type EventInfo interface {
 	Sys() interface{} // underlying data source (can return nil)
 }
 
+// MoveInfo describes a single move of a file or directory. The Path of the event
+// is its new path, while OldPath gives the path it was moved from. OldPath is
+// empty when the path the file was moved from is unknown.
+type MoveInfo interface {
+	EventInfo
+	OldPath() string // old path of the file or directory
+}
+
 type isDirer interface {
 	isDir() (bool, error)
 }
@@ -123,11 +171,63 @@ func (e *event) String() string {
 	return e.Event().String() + `: "` + e.Path() + `"`
 }
 
+// synthetic is an event created by notify itself rather than reported by
+// the underlying watcher, e.g. as a result of a rescan.
+type synthetic struct {
+	e   Event
+	p   string
+	d   bool
+	sys interface{}
+}
+
+var _ fmt.Stringer = (*synthetic)(nil)
+var _ isDirer = (*synthetic)(nil)
+
+func (e *synthetic) Event() Event         { return e.e }
+func (e *synthetic) Path() string         { return e.p }
+func (e *synthetic) Sys() interface{}     { return e.sys }
+func (e *synthetic) isDir() (bool, error) { return e.d, nil }
+
+// String implements fmt.Stringer interface.
+func (e *synthetic) String() string {
+	return e.Event().String() + `: "` + e.Path() + `"`
+}
+
+// moved is an event delivered to channels listening for Move events.
+type moved struct {
+	e   Event // Move, or Create or Remove for unpaired rename events
+	p   string
+	old string
+	d   bool
+	sys interface{}
+}
+
+var _ fmt.Stringer = (*moved)(nil)
+var _ isDirer = (*moved)(nil)
+var _ MoveInfo = (*moved)(nil)
+
+func (e *moved) Event() Event         { return e.e }
+func (e *moved) Path() string         { return e.p }
+func (e *moved) OldPath() string      { return e.old }
+func (e *moved) Sys() interface{}     { return e.sys }
+func (e *moved) isDir() (bool, error) { return e.d, nil }
+
+// String implements fmt.Stringer interface.
+func (e *moved) String() string {
+	if e.old == "" {
+		return e.Event().String() + `: "` + e.Path() + `"`
+	}
+	return e.Event().String() + `: "` + e.OldPath() + `" -> "` + e.Path() + `"`
+}
+
 var estr = map[Event]string{
-	Create: "notify.Create",
-	Remove: "notify.Remove",
-	Write:  "notify.Write",
-	Rename: "notify.Rename",
+	Create:      "notify.Create",
+	Remove:      "notify.Remove",
+	Write:       "notify.Write",
+	Rename:      "notify.Rename",
+	Overflow:    "notify.Overflow",
+	Move:        "notify.Move",
+	Invalidated: "notify.Invalidated",
 	// Display name for recursive event is added only for debugging
 	// purposes. It's an internal event after all and won't be exposed to the
 	// user. Having Recursive event printable is helpful, e.g. for reading
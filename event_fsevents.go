@@ -18,6 +18,14 @@ const (
 	// omit is used for dispatching internal events; only those events are sent
 	// for which both the event and the watchpoint has omit in theirs event sets.
 	omit = Event(0x400000)
+	// overflow is reported when the underlying watcher lost track of events,
+	// e.g. due to its queue being overflowed.
+	overflow = Event(0x800000)
+	// move is reported for a pair of rename events, which describe a single
+	// file being moved.
+	move = Event(0x1000000)
+	// invalidated is reported when the path of a watchpoint is gone.
+	invalidated = Event(0x2000000)
 )
 
 // FSEvents specific event values.
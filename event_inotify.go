@@ -23,6 +23,19 @@ const (
 	omit
 )
 
+// overflow is reported when the underlying watcher lost track of events, e.g.
+// due to its queue being overflowed. It does not follow omit, since that bit
+// is taken by IN_EXCL_UNLINK.
+const overflow Event = 0x8000000
+
+// move is reported for a pair of rename events, which describe a single file
+// being moved. It uses one of the bits unused by inotify.
+const move Event = 0x80000
+
+// invalidated is reported when the path of a watchpoint is gone. It uses one
+// of the bits unused by inotify.
+const invalidated Event = 0x40000
+
 // Inotify specific masks are legal, implemented events that are guaranteed to
 // work with notify package on linux-based systems.
 const (
@@ -68,6 +81,7 @@ type event struct {
 	sys   unix.InotifyEvent
 	path  string
 	event Event
+	wd    *watched // watch the event was read for
 }
 
 func (e *event) Event() Event         { return e.event }
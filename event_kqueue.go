@@ -24,6 +24,14 @@ const (
 	// omit is used for dispatching internal events; only those events are sent
 	// for which both the event and the watchpoint has omit in theirs event sets.
 	omit
+	// overflow is reported when the underlying watcher lost track of events,
+	// e.g. due to its queue being overflowed.
+	overflow
+	// move is reported for a pair of rename events, which describe a single
+	// file being moved.
+	move
+	// invalidated is reported when the path of a watchpoint is gone.
+	invalidated
 )
 
 const (
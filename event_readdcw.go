@@ -26,6 +26,14 @@ const (
 	omit
 	// dirmarker TODO(pknap)
 	dirmarker
+	// overflow is reported when the underlying watcher lost track of events,
+	// e.g. due to its queue being overflowed.
+	overflow
+	// move is reported for a pair of rename events, which describe a single
+	// file being moved.
+	move
+	// invalidated is reported when the path of a watchpoint is gone.
+	invalidated
 )
 
 // ReadDirectoryChangesW filters
@@ -0,0 +1,388 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Include limits the events delivered for the watch to the ones whose paths
+// match at least one of the given glob patterns. It can be used more than once,
+// adding more patterns.
+//
+// Patterns are matched against slash-separated paths relative to the watched
+// directory. In addition to the path.Match syntax, a "**" path element matches
+// any number of path elements. A pattern without a slash matches the base name
+// of a path at any depth, e.g. "*.go" is the same as "**/*.go".
+//
+// Include filters events only, it does not limit the directories which are
+// watched.
+func Include(patterns ...string) WatchOption {
+	return func(o *watchOptions) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// Exclude drops the events delivered for the watch, whose paths or any of
+// their parent directories match at least one of the given glob patterns. It
+// can be used more than once, adding more patterns. For the pattern syntax see
+// Include.
+//
+// Directories excluded from a recursive watch are not watched at all, unless
+// they are required by other watches, which means they do not consume any
+// system resources, e.g. inotify watches. On platforms, which natively support
+// recursive watching (FSEvents and ReadDirectoryChangesW), excluded directories
+// are still watched by the OS, but their events are discarded.
+//
+// Exclude takes precedence over Include.
+func Exclude(patterns ...string) WatchOption {
+	return func(o *watchOptions) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// ByName makes the watchpoint on a file follow its name instead of the file
+// itself. The parent directory of the file is watched instead and only events
+// of the name are delivered, so the watchpoint keeps working after the file is
+// replaced, e.g. by an editor, which saves files by writing a temporary one and
+// renaming it over the original. Such a save is reported with a Create or Move
+// event of the file, depending on the platform.
+//
+// The file does not need to exist, its parent directory does. Symlinks are
+// resolved once, when the watchpoint is set up. ByName has no effect for
+// directories and recursive watchpoints.
+func ByName() WatchOption {
+	return func(o *watchOptions) {
+		o.byname = true
+	}
+}
+
+// glob is a compiled glob pattern split into path elements.
+type glob []string
+
+func newGlob(pattern string) (glob, error) {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if pattern == "" {
+		return nil, path.ErrBadPattern
+	}
+	g := glob(strings.Split(pattern, "/"))
+	if len(g) == 1 && g[0] != "**" {
+		g = glob{"**", g[0]}
+	}
+	for _, elem := range g {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// match reports whether the pattern matches the path given by its elements.
+func (g glob) match(elems []string) bool {
+	for len(g) != 0 {
+		if g[0] == "**" {
+			if g = g[1:]; len(g) == 0 {
+				return true
+			}
+			for i := range elems {
+				if g.match(elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(g[0], elems[0]); !ok {
+			return false
+		}
+		g, elems = g[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// filter is a set of compiled Include and Exclude patterns of a single watch,
+// optionally extended with ignore files found in the watched directory.
+type filter struct {
+	include []glob
+	exclude []glob
+	ign     *ignorer
+}
+
+// newFilter compiles patterns given by o for a watch on the path. It returns
+// nil filter if o has none.
+func newFilter(o *watchOptions, path string) (*filter, error) {
+	if o == nil || len(o.include) == 0 && len(o.exclude) == 0 && !o.gitignore {
+		return nil, nil
+	}
+	f := &filter{}
+	if o.gitignore {
+		f.ign = newIgnorer(path)
+	}
+	for _, p := range o.include {
+		g, err := newGlob(p)
+		if err != nil {
+			return nil, &WatchError{Op: "include", Path: p, Err: err}
+		}
+		f.include = append(f.include, g)
+	}
+	for _, p := range o.exclude {
+		g, err := newGlob(p)
+		if err != nil {
+			return nil, &WatchError{Op: "exclude", Path: p, Err: err}
+		}
+		f.exclude = append(f.exclude, g)
+	}
+	return f, nil
+}
+
+// excluding reports whether the filter excludes anything.
+func (f *filter) excluding() bool {
+	return f != nil && (len(f.exclude) != 0 || f.ign != nil)
+}
+
+// excludes reports whether the path relative to the watched directory, or any
+// of its parents, is excluded. Nil filter excludes nothing.
+func (f *filter) excludes(rel string, isdir bool) bool {
+	if !f.excluding() || rel == "" {
+		return false
+	}
+	if f.ign.ignored(rel, isdir) {
+		return true
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i <= len(elems); i++ {
+		for _, g := range f.exclude {
+			if g.match(elems[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accepts reports whether the event for the path relative to the watched
+// directory is to be delivered. Nil filter accepts everything.
+func (f *filter) accepts(rel string, isdir bool) bool {
+	if f == nil || rel == "" {
+		return true
+	}
+	if f.excludes(rel, isdir) {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for _, g := range f.include {
+		if g.match(elems) {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusions maps paths of recursive watchpoints to filters of their channels.
+type exclusions map[string]map[chan<- EventInfo]*filter
+
+// set registers the filter f of a recursive watchpoint for c on the given path.
+// It returns a function, which restores the previous one.
+func (ex exclusions) set(path string, c chan<- EventInfo, f *filter) func() {
+	fs, ok := ex[path]
+	if !ok {
+		fs = make(map[chan<- EventInfo]*filter)
+		ex[path] = fs
+	}
+	prev, ok := fs[c]
+	fs[c] = f
+	return func() {
+		switch {
+		case ok:
+			fs[c] = prev
+		case len(fs) == 1:
+			delete(ex, path)
+		default:
+			delete(fs, c)
+		}
+	}
+}
+
+// del removes the filter of the recursive watchpoint for c on the given path.
+func (ex exclusions) del(path string, c chan<- EventInfo) {
+	if fs, ok := ex[path]; ok {
+		if delete(fs, c); len(fs) == 0 {
+			delete(ex, path)
+		}
+	}
+}
+
+// stop removes filters of all recursive watchpoints for c.
+func (ex exclusions) stop(c chan<- EventInfo) {
+	for path := range ex {
+		ex.del(path, c)
+	}
+}
+
+// excluded reports whether the directory is excluded by every recursive
+// watchpoint it is covered by.
+func (ex exclusions) excluded(dir string) (excluded bool) {
+	for path, fs := range ex {
+		i := indexrel(path, dir)
+		if i == -1 {
+			continue
+		}
+		for _, f := range fs {
+			if !f.excludes(dir[i:], true) {
+				return false
+			}
+			excluded = true
+		}
+	}
+	return excluded
+}
+
+// ignoring reports whether any recursive watchpoint covering the path honours
+// ignore files.
+func (ex exclusions) ignoring(path string) bool {
+	for p, fs := range ex {
+		if indexrel(p, path) == -1 {
+			continue
+		}
+		for _, f := range fs {
+			if f != nil && f.ign != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excluding reports whether any recursive watchpoint other than the one for c
+// on the given path, which overlaps with it, excludes some directories.
+func (ex exclusions) excluding(path string, c chan<- EventInfo) bool {
+	for p, fs := range ex {
+		if p != path && indexrel(p, path) == -1 && indexrel(path, p) == -1 {
+			continue
+		}
+		for ch, f := range fs {
+			if (p != path || ch != c) && f.excluding() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scope is a single watch registered for a channel.
+type scope struct {
+	path   string // watched path
+	isrec  bool   // whether the watch is recursive
+	events Event  // events the channel listens on
+	f      *filter
+	o      *watchOptions // options the watch was set up with, may be nil
+	name   bool          // whether the file is watched by its name
+}
+
+// watched gives the path the tree watches for the scope, which is the parent
+// directory for a file watched by its name.
+func (s scope) watched() string {
+	if s.name {
+		return filepath.Dir(s.path)
+	}
+	return s.path
+}
+
+// rel gives the path p relative to the watched path and reports whether p is
+// covered by the watch.
+func (s scope) rel(p string) (string, bool) {
+	if p == s.path {
+		return "", true
+	}
+	if s.name {
+		// Other paths within the parent directory are covered as well, so
+		// their events get rejected.
+		return "", p == filepath.Dir(s.path) || filepath.Dir(p) == filepath.Dir(s.path)
+	}
+	i := indexrel(s.path, p)
+	if i == -1 {
+		return "", false
+	}
+	rel := p[i:]
+	if !s.isrec && indexSep(rel) != -1 {
+		return "", false
+	}
+	return rel, true
+}
+
+// scopes is a list of watches registered for a channel.
+type scopes []scope
+
+// set adds s to the list, expanding the events of the previous watch of the
+// same kind on the same path and replacing its filter.
+func (ss scopes) set(s scope) scopes {
+	for i := range ss {
+		if ss[i].path == s.path && ss[i].isrec == s.isrec {
+			s.events |= ss[i].events
+			ss[i] = s
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+// del removes the events from the watch of the given kind on the path. The
+// watch is removed once it has no events left.
+func (ss scopes) del(path string, isrec bool, events Event) scopes {
+	for i := range ss {
+		if ss[i].path == path && ss[i].isrec == isrec {
+			if ss[i].events &^= events; ss[i].events == 0 {
+				ss = append(ss[:i], ss[i+1:]...)
+			}
+			break
+		}
+	}
+	return ss
+}
+
+// get gives the watch of the given kind on the path.
+func (ss scopes) get(path string, isrec bool) (scope, bool) {
+	for _, s := range ss {
+		if s.path == path && s.isrec == isrec {
+			return s, true
+		}
+	}
+	return scope{}, false
+}
+
+// accepts reports whether an event for the path p is to be delivered. It is
+// the case if at least one watch covering p accepts it or no watch covers p.
+func (ss scopes) accepts(p string, isdir bool) bool {
+	covered := false
+	for _, s := range ss {
+		rel, ok := s.rel(p)
+		if !ok {
+			continue
+		}
+		if (!s.name || p == s.path) && s.f.accepts(rel, isdir) {
+			return true
+		}
+		covered = true
+	}
+	return !covered
+}
+
+// filtered reports whether any of the watches has a filter or watches a file
+// by its name.
+func (ss scopes) filtered() bool {
+	for _, s := range ss {
+		if s.f != nil || s.name {
+			return true
+		}
+	}
+	return false
+}
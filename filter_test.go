@@ -0,0 +1,124 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := [...]struct {
+		pattern string
+		path    string
+		ok      bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/gotree/main.go", true},
+		{"*.go", "main.txt", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/gotree/main.go", false},
+		{"cmd/**/*.go", "cmd/main.go", true},
+		{"cmd/**/*.go", "cmd/gotree/main.go", true},
+		{"cmd/**", "cmd/gotree/main.go", true},
+		{"cmd/**", "fs.go", false},
+		{"**/testdata/**", "a/b/testdata/c/d", true},
+		{"**/testdata/**", "a/b/testdata", true},
+		{"node_modules", "a/node_modules", true},
+		{"/node_modules/", "node_modules", true},
+		{"a/?/c", "a/b/c", true},
+		{"a/[bc]/d", "a/e/d", false},
+	}
+	for i, cas := range cases {
+		g, err := newGlob(cas.pattern)
+		if err != nil {
+			t.Fatalf("newGlob(%q)=%v (i=%d)", cas.pattern, err, i)
+		}
+		if ok := g.match(strings.Split(cas.path, "/")); ok != cas.ok {
+			t.Errorf("want %q match %q=%t; got %t (i=%d)", cas.pattern, cas.path, cas.ok, ok, i)
+		}
+	}
+	for _, pattern := range []string{"", "/", "a/[", "[]"} {
+		if _, err := newGlob(pattern); err == nil {
+			t.Errorf("want newGlob(%q) to fail", pattern)
+		}
+	}
+}
+
+func TestFilterAccepts(t *testing.T) {
+	f, err := newFilter(newWatchOptions([]WatchOption{
+		Include("*.go", "Makefile"),
+		Exclude(".git", "vendor/**", "*_test.go"),
+	}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"":                    true,
+		"main.go":             true,
+		"cmd/main.go":         true,
+		"Makefile":            true,
+		"README.md":           false,
+		"main_test.go":        false,
+		".git":                false,
+		".git/hooks/pre.go":   false,
+		"vendor":              false,
+		"vendor/x/y.go":       false,
+		"sub/.git/objects.go": false,
+	}
+	for rel, ok := range cases {
+		if got := f.accepts(filepath.FromSlash(rel), false); got != ok {
+			t.Errorf("want accepts(%q)=%t; got %t", rel, ok, got)
+		}
+	}
+	if _, err := newFilter(newWatchOptions([]WatchOption{Exclude("[")}), ""); err == nil {
+		t.Error("want newFilter to fail for invalid pattern")
+	}
+	if f, err := newFilter(newWatchOptions(nil), ""); f != nil || err != nil {
+		t.Errorf("want nil filter; got %v, %v", f, err)
+	}
+}
+
+func TestScopesAccepts(t *testing.T) {
+	exclude, err := newFilter(newWatchOptions([]WatchOption{Exclude("b")}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.FromSlash("/root")
+	ss := scopes{}.set(scope{path: filepath.Join(root, "a"), isrec: true, f: exclude})
+	cases := map[string]bool{
+		"a/x":     true,
+		"a/b":     false,
+		"a/b/x":   false,
+		"a/c/b/x": false,
+		"c/b":     true, // not covered by any scope
+	}
+	for p, ok := range cases {
+		if got := ss.accepts(filepath.Join(root, filepath.FromSlash(p)), false); got != ok {
+			t.Errorf("want accepts(%q)=%t; got %t", p, ok, got)
+		}
+	}
+	ss = ss.set(scope{path: filepath.Join(root, "a", "b")})
+	if p := filepath.Join(root, "a", "b", "x"); !ss.accepts(p, false) {
+		t.Errorf("want %q to be accepted by non-filtered scope", p)
+	}
+	if p := filepath.Join(root, "a", "b", "x", "y"); ss.accepts(p, false) {
+		t.Errorf("want %q not to be accepted by non-recursive scope", p)
+	}
+	ss = scopes{}.set(scope{path: filepath.Join(root, "c", "app.conf"), name: true})
+	cases = map[string]bool{
+		"c/app.conf":      true,
+		"c/.app.conf.swp": false,
+		"c":               false,
+		"c/d/app.conf":    true, // not covered by any scope
+		"a/c/app.conf":    true, // not covered by any scope
+	}
+	for p, ok := range cases {
+		if got := ss.accepts(filepath.Join(root, filepath.FromSlash(p)), false); got != ok {
+			t.Errorf("want accepts(%q)=%t; got %t", p, ok, got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ignoreFiles lists names of ignore files in the order of their precedence,
+// rules from the latter ones override rules from the former ones.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// Gitignore makes the watch honour .gitignore and .ignore files found within
+// the watched directory, following git's precedence rules: rules from ignore
+// files in deeper directories override the ones from their parents, rules from
+// .ignore override the ones from .gitignore in the same directory, and later
+// rules override earlier ones. Like in git, it is not possible to re-include
+// a path if its parent directory is ignored.
+//
+// Ignored paths are excluded from the watch the same way paths given to Exclude
+// are. Ignore files are read again when they change, after which directories
+// that are no longer ignored get watched, and the newly ignored ones stop
+// being watched.
+//
+// Ignore files outside of the watched directory, and git's global excludes,
+// are not taken into account. On platforms, which natively support recursive
+// watching (FSEvents and ReadDirectoryChangesW), changes to ignore files are
+// noticed only if the watch listens for the events they cause.
+func Gitignore() WatchOption {
+	return func(o *watchOptions) {
+		o.gitignore = true
+	}
+}
+
+// ignoreRule is a single pattern read from an ignore file.
+type ignoreRule struct {
+	g       glob
+	negate  bool // pattern starts with "!"
+	dironly bool // pattern ends with "/"
+	inside  bool // pattern ends with "/**", it matches paths below only
+}
+
+// parseIgnore parses the content of an ignore file.
+func parseIgnore(p []byte) (rules []ignoreRule) {
+	s := bufio.NewScanner(bytes.NewReader(p))
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		var r ignoreRule
+		switch {
+		case strings.HasPrefix(line, "!"):
+			r.negate, line = true, line[1:]
+		case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dironly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if strings.HasSuffix(line, "/**") {
+			r.inside, line = true, strings.TrimSuffix(line, "/**")
+		}
+		g, err := newGlob(line)
+		if err != nil {
+			continue // git ignores invalid patterns as well
+		}
+		if anchored && len(g) == 2 && g[0] == "**" && !strings.HasPrefix(line, "**") {
+			g = g[1:] // newGlob unanchors single element patterns
+		}
+		r.g = g
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// match reports whether the rule matches the path given by its elements, which
+// is relative to the directory of the ignore file.
+func (r ignoreRule) match(elems []string, isdir bool) bool {
+	if !r.inside {
+		return (isdir || !r.dironly) && r.g.match(elems)
+	}
+	for i := 1; i < len(elems); i++ {
+		if r.g.match(elems[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignorer evaluates ignore files found within a watched directory.
+type ignorer struct {
+	root  string
+	mu    sync.Mutex              // protects rules
+	rules map[string][]ignoreRule // rules of a directory, relative to root
+}
+
+func newIgnorer(root string) *ignorer {
+	return &ignorer{
+		root:  root,
+		rules: make(map[string][]ignoreRule),
+	}
+}
+
+// dirrules gives the rules of ignore files found in the directory, relative to
+// the root. It expects ig.mu to be locked.
+func (ig *ignorer) dirrules(dir string) []ignoreRule {
+	rules, ok := ig.rules[dir]
+	if !ok {
+		for _, name := range ignoreFiles {
+			p, err := os.ReadFile(filepath.Join(ig.root, filepath.FromSlash(dir), name))
+			if err == nil {
+				rules = append(rules, parseIgnore(p)...)
+			}
+		}
+		ig.rules[dir] = rules
+	}
+	return rules
+}
+
+// match reports whether the path given by its elements, relative to the root,
+// is matched by ignore rules.
+func (ig *ignorer) match(elems []string, isdir bool) (ignored bool) {
+	for i := range elems {
+		for _, r := range ig.dirrules(strings.Join(elems[:i], "/")) {
+			if r.match(elems[i:], isdir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ignored reports whether the path relative to the root, or any of its parent
+// directories, is ignored.
+func (ig *ignorer) ignored(rel string, isdir bool) bool {
+	if ig == nil || rel == "" {
+		return false
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	for i := 1; i <= len(elems); i++ {
+		if ig.match(elems[:i], isdir || i < len(elems)) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidate drops the cached rules of the given directory, so they are read
+// again on next use. It is a nop if dir is not within the root.
+func (ig *ignorer) invalidate(dir string) {
+	var rel string
+	if dir != ig.root {
+		i := indexrel(ig.root, dir)
+		if i == -1 {
+			return
+		}
+		rel = filepath.ToSlash(dir[i:])
+	}
+	ig.mu.Lock()
+	delete(ig.rules, rel)
+	ig.mu.Unlock()
+}
+
+// isIgnoreFile reports whether the base of the path is a name of an ignore
+// file.
+func isIgnoreFile(path string) bool {
+	name := base(path)
+	for _, s := range ignoreFiles {
+		if name == s {
+			return true
+		}
+	}
+	return false
+}
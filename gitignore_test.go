@@ -0,0 +1,67 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorer(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":       "# comment\n*.log\n/build/\ntmp\n!keep.log\nsrc/gen/**\n",
+		".ignore":          "secret\n",
+		"src/.gitignore":   "!*.log\n/local\n",
+		"sub/.gitignore":   "*.txt\n",
+		"sub/.ignore":      "!important.txt\n",
+		"sub/tmp/.ignore":  "!x\n",
+		"build/.gitignore": "",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		mustT(t, os.MkdirAll(filepath.Dir(name), 0755))
+		mustT(t, os.WriteFile(name, []byte(content), 0644))
+	}
+	ig := newIgnorer(root)
+	cases := [...]struct {
+		rel     string
+		isdir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},
+		{"x/a.log", false, true},
+		{"src/a.log", false, false},         // re-included by a deeper file
+		{"build", true, true},               // directory only
+		{"build", false, false},             // directory only
+		{"x/build", true, false},            // anchored
+		{"tmp", false, true},                // unanchored
+		{"x/tmp/y", false, true},            // parent is ignored
+		{"sub/tmp/x", false, true},          // parent cannot be re-included
+		{"secret", false, true},             // .ignore
+		{"src/local", false, true},          // anchored to src
+		{"local", false, false},             // anchored to src
+		{"src/gen", true, false},            // /** matches inside only
+		{"src/gen/a.go", false, true},       // /** matches inside only
+		{"sub/a.txt", false, true},          // .gitignore in sub
+		{"sub/important.txt", false, false}, // .ignore overrides .gitignore
+		{"a.txt", false, false},
+	}
+	for i, cas := range cases {
+		if ignored := ig.ignored(filepath.FromSlash(cas.rel), cas.isdir); ignored != cas.ignored {
+			t.Errorf("want ignored(%q, %t)=%t; got %t (i=%d)", cas.rel, cas.isdir, cas.ignored, ignored, i)
+		}
+	}
+	mustT(t, os.WriteFile(filepath.Join(root, ".ignore"), nil, 0644))
+	if !ig.ignored("secret", false) {
+		t.Fatal("want rules to be cached until invalidated")
+	}
+	ig.invalidate(root)
+	if ig.ignored("secret", false) {
+		t.Fatal("want rules to be read again after invalidation")
+	}
+}
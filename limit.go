@@ -0,0 +1,180 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Rollback makes a recursive watch all-or-nothing: if any directory within it
+// fails to be watched, e.g. because the watch limit was reached, all of the
+// directories watched so far are unwatched and WatchWith fails.
+//
+// By default a recursive watch, which reached the watch limit, stays in place
+// covering the directories watched so far, while the *WatchLimitError is sent
+// to the Errors channel. Directories, which are not watched, are tried again
+// when they get recreated or rescanned.
+//
+// Rollback has effect only on platforms, which watch every directory of
+// recursive watchpoints separately (inotify, kqueue and FEN). With
+// WithPollFallback the watch limit does not fail the watch.
+func Rollback() WatchOption {
+	return func(o *watchOptions) {
+		o.rollback = true
+	}
+}
+
+// WithPollFallback makes the Notifier poll directories of recursive watchpoints,
+// which could not be watched because the watch limit was reached. The polled
+// directories are scanned with the given interval, which yields Create, Remove
+// and Write events only. Non-positive interval means the default one.
+//
+// Polled directories are reported with Kernel set to false by Watches.
+// Once the watch limit is reached, directories created within recursive
+// watchpoints are tried to be watched first, before falling back to polling.
+//
+// The default interval is 1s. WithPollFallback has effect only on platforms,
+// which watch every directory of recursive watchpoints separately (inotify,
+// kqueue and FEN). Under Linux it makes the watchpoint tree emulate recursive
+// watchpoints instead of inotify.
+func WithPollFallback(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.poll = interval
+		}
+		o.pollfb = true
+	}
+}
+
+// recwatch is a state of a traversal, which sets up internal watchpoints of
+// a recursive watchpoint.
+type recwatch struct {
+	rollback bool             // whether to undo the traversal on failure
+	undo     []recundo        // nodes changed by the traversal, in order
+	added    int              // number of newly watched directories
+	limit    *WatchLimitError // set once the watch limit was reached
+	err      error            // error, which stopped the traversal
+}
+
+// recundo is a node changed by a traversal and its previous internal events.
+type recundo struct {
+	nd   node
+	prev Event
+}
+
+// watcher gives the watcher holding the watch for the path, which is either
+// the underlying watcher or the poller. It expects t.rw to be locked.
+func (t *nonrecursiveTree) watcher(path string) watcher {
+	if t.poll != nil && t.poll.Watched(path) {
+		return t.poll
+	}
+	return t.w
+}
+
+// watchdir watches the directory of an internal watchpoint with the event set
+// e. Once the watch limit was reached it either polls the directory or fails
+// with the limit error. Other errors are reported, unless the traversal is
+// to be rolled back. It expects t.rw to be locked.
+func (t *nonrecursiveTree) watchdir(name string, e Event, rw *recwatch) error {
+	if rw.limit == nil {
+		err := t.w.Watch(name, e)
+		switch {
+		case err == nil:
+			rw.added++
+			return nil
+		case errors.As(err, &rw.limit):
+			if t.poll != nil {
+				warn("watch limit reached, polling", "path", name, "err", err)
+			}
+		case rw.rollback:
+			return &WatchError{Op: "watch", Path: name, Err: err}
+		default:
+			t.errs.report(&WatchError{Op: "watch", Path: name, Err: err})
+			return nil
+		}
+	}
+	if t.poll == nil {
+		return rw.limit
+	}
+	if err := t.poll.Watch(name, e); err != nil {
+		t.errs.report(&WatchError{Op: "watch", Path: name, Err: err})
+	}
+	return nil
+}
+
+// addrec sets up internal watchpoints with the event set e for the subtree
+// rooted at nd, using the given traverse function. If the watch limit was
+// reached, it fails with *WatchLimitError describing the whole subtree. On
+// failure the traversal is undone, if rollback is true. It expects t.rw to be
+// locked.
+func (t *nonrecursiveTree) addrec(nd node, traverse func(walkFunc) error, e Event, rollback bool) error {
+	rw := &recwatch{rollback: rollback}
+	err := traverse(t.recFunc(e, rw))
+	if rw.limit != nil {
+		rw.limit.Needed = rw.added + t.unwatched(nd)
+	}
+	if rw.err != nil {
+		err = rw.err
+	}
+	if err != nil && rollback {
+		t.rollback(rw)
+	}
+	if err != nil {
+		prune(nd)
+	}
+	return err
+}
+
+// rollback undoes the traversal rw. It expects t.rw to be locked.
+func (t *nonrecursiveTree) rollback(rw *recwatch) {
+	for i := len(rw.undo) - 1; i >= 0; i-- {
+		nd, prev := rw.undo[i].nd, rw.undo[i].prev
+		switch diff := nd.Watch.Del(t.rec, nd.Watch[t.rec]&^prev); {
+		case diff == none:
+		case diff[1] == 0:
+			if err := t.watcher(nd.Name).Unwatch(nd.Name); err != nil {
+				t.errs.report(&WatchError{Op: "unwatch", Path: nd.Name, Err: err})
+			}
+		default:
+			if err := t.watcher(nd.Name).Rewatch(nd.Name, diff[0], diff[1]); err != nil {
+				t.errs.report(&WatchError{Op: "rewatch", Path: nd.Name, Err: err})
+			}
+		}
+	}
+}
+
+// unwatched gives the number of directories within the subtree rooted at nd,
+// which are neither watched nor excluded. It expects t.rw to be locked.
+func (t *nonrecursiveTree) unwatched(nd node) (n int) {
+	filepath.WalkDir(nd.Name, func(path string, de fs.DirEntry, err error) error {
+		switch {
+		case err != nil || !de.IsDir():
+			return nil
+		case t.excl.excluded(path):
+			return filepath.SkipDir
+		}
+		if it, err := t.root.Get(path); err != nil || it.Watch.Total() == 0 {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// prune removes nodes with neither watchpoints nor children from the subtree
+// rooted at nd, excluding nd itself.
+func prune(nd node) {
+	for name, child := range nd.Child {
+		if name == "" {
+			continue
+		}
+		if prune(child); len(child.Watch) == 0 && len(child.Child) == 0 {
+			delete(nd.Child, name)
+		}
+	}
+}
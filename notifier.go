@@ -0,0 +1,278 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// Notifier is an independent instance of notify. Each Notifier owns its own
+// watchpoint tree and an underlying filesystem watcher, which means watches
+// set up with one Notifier never interfere with the ones set up with another.
+//
+// The package-level Watch and Stop functions use a default Notifier, which is
+// never closed.
+//
+// It is safe to use Notifier from multiple goroutines.
+type Notifier struct {
+	mu      sync.RWMutex // protects closed
+	closed  bool
+	tree    tree
+	backend Backend
+	errs    *errorsChan
+	opts    options
+	subs    subscriptions
+}
+
+// Option configures a Notifier.
+type Option func(*options)
+
+type options struct {
+	buffer  int           // size of internal event buffers
+	rescan  bool          // whether to rescan recursive watchpoints on overflow
+	move    time.Duration // pairing window for Move events
+	order   int           // number of dispatching workers, 0 means unbounded
+	poll    time.Duration // interval of polling, 0 means the default one
+	pollfb  bool          // whether to poll directories over the watch limit
+	backend Backend       // selected backend
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		buffer: buffer,
+		move:   moveWindow,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithBuffer sets the size of internal buffers used for passing events from
+// the filesystem watcher to the watchpoint tree. Non-positive n is ignored.
+//
+// The default size is 128.
+func WithBuffer(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.buffer = n
+		}
+	}
+}
+
+// WithRescan enables rescanning recursive watchpoints after the underlying
+// watcher reported an Overflow. During a rescan every directory covered by
+// a recursive watchpoint is read again: directories that appeared during the
+// overflow are watched and reported with Create events - together with their
+// content - while directories that disappeared are unwatched and reported
+// with Remove events.
+//
+// Rescan is able to detect changes in the directory structure only, changes
+// to files within already watched directories are still lost. Therefore
+// Overflow events are always delivered, with or without rescan.
+//
+// Rescan has effect only on platforms, which watch every directory of
+// recursive watchpoints separately (inotify, kqueue and FEN).
+func WithRescan() Option {
+	return func(o *options) {
+		o.rescan = true
+	}
+}
+
+// moveWindow is the default pairing window for Move events.
+const moveWindow = 50 * time.Millisecond
+
+// WithMoveWindow sets the maximum time to wait for the other rename event of
+// a move. When it elapses, the move is reported as unpaired Remove or Create
+// event instead. Non-positive d is ignored.
+//
+// The default window is 50ms.
+func WithMoveWindow(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.move = d
+		}
+	}
+}
+
+// WithOrdered makes the Notifier dispatch events using a fixed pool of workers
+// instead of a goroutine per event, guaranteeing the order of delivered events.
+// Events for a single path are always dispatched by the same worker, so every
+// channel receives them in the order they were reported by the OS. A single
+// worker guarantees every channel receives all of its events in order.
+// Non-positive workers is treated as 1.
+//
+// A worker sends events one at a time, therefore a channel with the Block
+// delivery policy delays other events dispatched by the same worker until its
+// receiver is ready. DropOldest and Unbounded policies preserve the order.
+//
+// Move events are paired asynchronously, they may be delivered after events
+// which were reported after them by the OS. By default events are dispatched
+// concurrently, without any ordering guarantee.
+func WithOrdered(workers int) Option {
+	return func(o *options) {
+		if workers <= 0 {
+			workers = 1
+		}
+		o.order = workers
+	}
+}
+
+// WithPolling makes the Notifier use a polling watcher instead of the native
+// one. The polling watcher scans watched paths with the given interval and
+// compares the state of files with the one of the previous scan. It works
+// on filesystems, which do not support native notifications, like NFS, SMB or
+// FUSE. Non-positive interval means the default one.
+//
+// The polling watcher reports Create, Remove, Write, Rename and Move events.
+// Renames are detected by inode numbers, on platforms which do not expose
+// them renames are reported with Remove and Create events. Changes which
+// happen between two scans and cancel each other out are not reported.
+//
+// The default interval is 1s. On platforms without a native watcher polling is
+// used by default.
+func WithPolling(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.poll = interval
+		}
+		o.backend = Polling
+	}
+}
+
+// NewNotifier creates a new Notifier configured with the given options.
+//
+// The underlying filesystem watcher is created eagerly, however any error
+// that happens during its initialization is reported by the first Watch call.
+// The Notifier must be closed in order to release its resources.
+func NewNotifier(opts ...Option) *Notifier {
+	n := &Notifier{opts: newOptions(opts)}
+	n.errs = newErrorsChan(n.opts.buffer)
+	n.errs.sub = n.subs.report
+	n.tree, n.backend = newTree(&n.opts, n.errs)
+	return n
+}
+
+// Watch sets up a watchpoint on path listening for events given by the events
+// argument. It works exactly as the package-level Watch function, but is
+// scoped to the Notifier n.
+//
+// Watch fails if n was closed.
+func (n *Notifier) Watch(path string, c chan<- EventInfo, events ...Event) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return watchError("watch", path, ErrClosed)
+	}
+	return watchError("watch", path, n.tree.Watch(path, c, events...))
+}
+
+// WatchWith works like Watch, additionally configuring the watch with the given
+// options. The events argument is an event set joint using bitwise OR operator.
+//
+// Delivery policy is a property of the channel c, all its watchpoints share
+// it. The policy is set by the first WatchWith call that registers c within n,
+// either explicitly or implicitly with the default DropNewest policy. Passing
+// different policy for c afterwards fails, until c is stopped.
+func (n *Notifier) WatchWith(path string, c chan<- EventInfo, events Event, opts ...WatchOption) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return watchError("watch", path, ErrClosed)
+	}
+	return watchError("watch", path, n.tree.WatchWith(path, c, newWatchOptions(opts), events))
+}
+
+// Unwatch removes the events from the watchpoint registered for c on the path.
+// It works exactly as the package-level Unwatch function, but is scoped to the
+// Notifier n.
+//
+// Unwatch fails if n was closed.
+func (n *Notifier) Unwatch(path string, c chan<- EventInfo, events ...Event) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return watchError("unwatch", path, ErrClosed)
+	}
+	e := all
+	if len(events) != 0 {
+		e = joinevents(events)
+	}
+	return watchError("unwatch", path, n.tree.Unwatch(path, c, e))
+}
+
+// Dropped gives the number of events, which were dropped for c due to its
+// delivery policy since it was registered within the Notifier n. Stopping
+// c resets the counter.
+func (n *Notifier) Dropped(c chan<- EventInfo) uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return 0
+	}
+	return n.tree.Dropped(c)
+}
+
+// Stats gives a snapshot of runtime statistics of the Notifier n. It is cheap
+// enough to be called periodically, although it counts the nodes of the
+// watchpoint tree, which takes time proportional to their number.
+//
+// Stats gives zero value if n was closed.
+func (n *Notifier) Stats() Statistics {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return Statistics{}
+	}
+	return n.tree.Stats()
+}
+
+// Stop removes all watchpoints registered for c within the Notifier n. It
+// works exactly as the package-level Stop function.
+//
+// Calling Stop on closed Notifier is a nop.
+func (n *Notifier) Stop(c chan<- EventInfo) {
+	// Subscriptions are locked before n, like in Subscribe.
+	n.subs.mu.Lock()
+	defer n.subs.mu.Unlock()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	n.subs.stop(c)
+	n.tree.Stop(c)
+}
+
+// Errors returns a channel, which receives errors that happened asynchronously
+// within the Notifier n, e.g. failures of setting watches for directories
+// created within recursive watchpoints or failures of the underlying watcher
+// itself. Each error is of *WatchError type.
+//
+// Errors are dropped if the receiver does not keep up with receiving them. The
+// channel is closed when n gets closed.
+func (n *Notifier) Errors() <-chan error {
+	return n.errs.c
+}
+
+// Close removes all watchpoints and releases all resources held by the
+// Notifier n, including the underlying filesystem watcher. When Close returns
+// no more events are sent to any of the channels registered with n.
+//
+// Close closes the channel returned by Errors. User channels are closed only
+// if they were watched with the CloseOnStop option, other ones are left open.
+// Calling Close more than once is a nop.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil
+	}
+	n.closed = true
+	err := n.tree.Close()
+	n.errs.close()
+	return err
+}
@@ -0,0 +1,688 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build darwin || linux || freebsd || dragonfly || netbsd || openbsd || windows || solaris
+// +build darwin linux freebsd dragonfly netbsd openbsd windows solaris
+
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifierIndependent(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	n1, n2 := NewNotifier(), NewNotifier(WithBuffer(16))
+	defer n2.Close()
+
+	c1, c2 := make(chan EventInfo, 16), make(chan EventInfo, 16)
+	mustT(t, n1.Watch(tmpDir, c1, Create))
+	mustT(t, n2.Watch(tmpDir, c2, Create))
+
+	mustT(t, n1.Close())
+	if err := n1.Watch(tmpDir, c1, Create); !errors.Is(err, ErrClosed) {
+		t.Fatalf("want err=%v; got %v", ErrClosed, err)
+	}
+	mustT(t, n1.Close())
+
+	file := filepath.Join(tmpDir, "file")
+	mustT(t, os.WriteFile(file, []byte("abc"), 0666))
+
+	select {
+	case ei := <-c2:
+		if !samefile(t, ei.Path(), file) {
+			t.Fatalf("want path=%s; got %s", file, ei.Path())
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+	select {
+	case ei := <-c1:
+		t.Fatalf("received an event on closed notifier: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifierErrorsClosed(t *testing.T) {
+	n := NewNotifier()
+	errs := n.Errors()
+	mustT(t, n.Close())
+	select {
+	case _, ok := <-errs:
+		if ok {
+			t.Fatal("want Errors channel to be closed")
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out waiting for Errors channel to be closed")
+	}
+}
+
+func TestNotifierWatchError(t *testing.T) {
+	tmpDir := t.TempDir()
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 1)
+	err := n.Unwatch(tmpDir, c)
+	if !errors.Is(err, ErrNotWatched) {
+		t.Fatalf("want err=%v; got %v", ErrNotWatched, err)
+	}
+	var werr *WatchError
+	if !errors.As(err, &werr) {
+		t.Fatalf("want err to be *WatchError; got %T", err)
+	}
+	if werr.Op != "unwatch" || werr.Path != tmpDir {
+		t.Fatalf("want Op=unwatch, Path=%s; got Op=%s, Path=%s", tmpDir, werr.Op, werr.Path)
+	}
+	err = n.Watch(filepath.Join(tmpDir, "nonexistent"), c, Create)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("want err=%v; got %v", fs.ErrNotExist, err)
+	}
+	if !errors.As(err, &werr) || werr.Op != "watch" {
+		t.Fatalf("want *WatchError with Op=watch; got %v", err)
+	}
+}
+
+func TestNotifierPolling(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.Mkdir(filepath.Join(tmpDir, "a"), 0755))
+	tmpDir, err := canonical(tmpDir)
+	mustT(t, err)
+
+	n := NewNotifier(WithPolling(10*time.Millisecond), WithOrdered(1))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(filepath.Join(tmpDir, "..."), c, Create, Move))
+
+	expect := func(e Event, path string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != e || ei.Path() != path {
+				t.Fatalf("want %v on %s; got %v", e, path, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for %v on %s", e, path)
+		}
+	}
+	file := filepath.Join(tmpDir, "a", "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	expect(Create, file)
+	moved := filepath.Join(tmpDir, "moved")
+	mustT(t, os.Rename(file, moved))
+	fi, err := os.Stat(moved)
+	mustT(t, err)
+	if fileid(fi) != (fileID{}) {
+		expect(Move, moved)
+	}
+	expect(Create, moved)
+}
+
+func TestNotifierBackend(t *testing.T) {
+	unavailable := Kqueue
+	if nativeBackend == Kqueue {
+		unavailable = FSEvents
+	}
+	cases := []struct {
+		opts []Option
+		want Backend
+	}{
+		{nil, nativeBackend},
+		{[]Option{WithBackend(Native)}, nativeBackend},
+		{[]Option{WithBackend(nativeBackend)}, nativeBackend},
+		{[]Option{WithBackend(unavailable)}, nativeBackend},
+		{[]Option{WithBackend(Polling)}, Polling},
+		{[]Option{WithPolling(time.Second)}, Polling},
+	}
+	for i, cas := range cases {
+		n := NewNotifier(cas.opts...)
+		if b := n.Backend(); b != cas.want {
+			t.Errorf("want backend=%v; got %v (i=%d)", cas.want, b, i)
+		}
+		mustT(t, n.Close())
+	}
+	if s := Polling.String(); s != "notify.Polling" {
+		t.Errorf("want Polling.String()=notify.Polling; got %s", s)
+	}
+}
+
+func TestNotifierExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"src", "node_modules/pkg"} {
+		mustT(t, os.MkdirAll(filepath.Join(tmpDir, dir), 0755))
+	}
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.WatchWith(filepath.Join(tmpDir, "..."), c, Create, Exclude("node_modules"), Include("*.go")))
+
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "node_modules", "pkg", "x.go"), nil, 0644))
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "src", "x.txt"), nil, 0644))
+	file := filepath.Join(tmpDir, "src", "x.go")
+	mustT(t, os.WriteFile(file, nil, 0644))
+
+	select {
+	case ei := <-c:
+		if !samefile(t, ei.Path(), file) {
+			t.Fatalf("want path=%s; got %s", file, ei.Path())
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifierGitignore(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "build"), 0755))
+	gitignore := filepath.Join(tmpDir, ".gitignore")
+	mustT(t, os.WriteFile(gitignore, []byte("build/\n"), 0644))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.WatchWith(filepath.Join(tmpDir, "..."), c, Create, Gitignore()))
+
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "build", "ignored"), nil, 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mustT(t, os.WriteFile(gitignore, nil, 0644))
+	deadline := time.After(timeout())
+	for i := 0; ; i++ {
+		file := filepath.Join(tmpDir, "build", fmt.Sprintf("file%d", i))
+		mustT(t, os.WriteFile(file, nil, 0644))
+		select {
+		case ei := <-c:
+			if filepath.Dir(ei.Path()) == filepath.Dir(file) {
+				return
+			}
+		case <-time.After(50 * time.Millisecond):
+			continue
+		case <-deadline:
+			t.Fatal("timed out waiting for event from no longer ignored directory")
+		}
+	}
+}
+
+func TestNotifierSubscribe(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "a", "b"), 0755))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	rec, err := n.Subscribe(filepath.Join(tmpDir, "..."), c, Create)
+	mustT(t, err)
+	sub, err := n.Subscribe(filepath.Join(tmpDir, "a", "b"), c, Create)
+	mustT(t, err)
+	if !rec.Recursive() || sub.Recursive() || rec.Events() != Create {
+		t.Fatalf("unexpected subscriptions: %+v, %+v", rec, sub)
+	}
+	if !samefile(t, sub.Path(), filepath.Join(tmpDir, "a", "b")) {
+		t.Fatalf("want path=%s; got %s", filepath.Join(tmpDir, "a", "b"), sub.Path())
+	}
+
+	mustT(t, rec.Close())
+	mustT(t, rec.Close())
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "a", "ignored"), nil, 0644))
+	file := filepath.Join(tmpDir, "a", "b", "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	select {
+	case ei := <-c:
+		if !samefile(t, ei.Path(), file) {
+			t.Fatalf("want path=%s; got %s", file, ei.Path())
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+
+	mustT(t, sub.Close())
+	if err := sub.Err(); err != nil {
+		t.Fatalf("want Err()=nil; got %v", err)
+	}
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "a", "b", "ignored"), nil, 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifierSubscribeShared(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	a, err := n.Subscribe(tmpDir, c, Create|Remove)
+	mustT(t, err)
+	b, err := n.Subscribe(tmpDir, c, Create)
+	mustT(t, err)
+	if b.Events() != Create {
+		t.Fatalf("want events=%v; got %v", Create, b.Events())
+	}
+
+	// Closing b keeps Create, which a still listens on.
+	mustT(t, b.Close())
+	file := filepath.Join(tmpDir, "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	select {
+	case ei := <-c:
+		if ei.Event() != Create || !samefile(t, ei.Path(), file) {
+			t.Fatalf("want Create on %s; got %v", file, ei)
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+
+	mustT(t, a.Close())
+	if wl := n.Watches(); len(wl) != 0 {
+		t.Fatalf("want no watches; got %v", wl)
+	}
+}
+
+func TestNotifierSubscribeStopped(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	old, err := n.Subscribe(tmpDir, c, Create)
+	mustT(t, err)
+	n.Stop(c)
+	mustT(t, n.Watch(tmpDir, c, Create))
+
+	// Closing the stopped subscription leaves the new watch intact.
+	mustT(t, old.Close())
+	file := filepath.Join(tmpDir, "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	select {
+	case ei := <-c:
+		if ei.Event() != Create || !samefile(t, ei.Path(), file) {
+			t.Fatalf("want Create on %s; got %v", file, ei)
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+}
+
+func TestNotifierSubscribeStopClose(t *testing.T) {
+	n := NewNotifier()
+	c := make(chan EventInfo, 16)
+
+	// Subscribe, which is setting up a watch, holds the subscriptions lock
+	// while waiting for the Notifier one.
+	n.subs.mu.Lock()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		n.Stop(c)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		n.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(timeout()):
+		t.Fatal("Close blocked by Stop waiting for subscriptions")
+	}
+	n.subs.mu.Unlock()
+	<-stopped
+}
+
+func TestNotifierSubscribeErr(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "a"), 0755))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	rec, err := n.Subscribe(filepath.Join(tmpDir, "..."), c, Create)
+	mustT(t, err)
+	sub, err := n.Subscribe(filepath.Join(tmpDir, "a"), c, Create)
+	mustT(t, err)
+
+	werr := &WatchError{Op: "watch", Path: filepath.Join(rec.Path(), "b", "c"), Err: ErrWatchLimit}
+	n.errs.report(werr)
+	if err := rec.Err(); err != werr {
+		t.Fatalf("want Err()=%v; got %v", werr, err)
+	}
+	if err := sub.Err(); err != nil {
+		t.Fatalf("want Err()=nil for a watch of another path; got %v", err)
+	}
+}
+
+func TestNotifierUnwatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "a"), 0755))
+	file := filepath.Join(tmpDir, "a", "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(filepath.Join(tmpDir, "..."), c, Create, Write))
+	mustT(t, n.Unwatch(filepath.Join(tmpDir, "..."), c, Write))
+	if err := n.Unwatch(tmpDir, c); err == nil {
+		t.Fatal("want Unwatch to fail for non-watched path")
+	}
+
+	mustT(t, os.WriteFile(file, []byte("x"), 0644))
+	created := filepath.Join(tmpDir, "a", "created")
+	mustT(t, os.WriteFile(created, nil, 0644))
+	select {
+	case ei := <-c:
+		if ei.Event() != Create || !samefile(t, ei.Path(), created) {
+			t.Fatalf("want Create on %s; got %v", created, ei)
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+
+	mustT(t, n.Unwatch(filepath.Join(tmpDir, "..."), c))
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "a", "ignored"), nil, 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifierCloseOnStop(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.WatchWith(tmpDir, c, Create, CloseOnStop()))
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "file"), nil, 0644))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range c {
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	n.Stop(c)
+	select {
+	case <-done:
+	case <-time.After(timeout()):
+		t.Fatal("timed out waiting for channel to be closed")
+	}
+}
+
+func TestNotifierOrdered(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	n := NewNotifier(WithOrdered(1))
+	defer n.Close()
+	c := make(chan EventInfo, 1)
+	mustT(t, n.WatchWith(tmpDir, c, Create|Write|Remove, DeliverUnbounded()))
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		file := filepath.Join(tmpDir, fmt.Sprintf("file%d", i))
+		mustT(t, os.WriteFile(file, []byte("x"), 0644))
+		mustT(t, os.Remove(file))
+	}
+	var got []EventInfo
+	for len(got) < 3*count {
+		select {
+		case ei := <-c:
+			got = append(got, ei)
+		case <-time.After(timeout()):
+			t.Fatalf("timed out, received %d events", len(got))
+		}
+	}
+	next := map[string]Event{}
+	for i, ei := range got {
+		want, ok := next[ei.Path()]
+		if !ok {
+			want = Create
+		}
+		if ei.Event() != want {
+			t.Fatalf("want %v on %s; got %v (i=%d)", want, ei.Path(), ei, i)
+		}
+		next[ei.Path()] = map[Event]Event{Create: Write, Write: Remove}[want]
+	}
+}
+
+func TestNotifierPersistent(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, err := canonical(tmpDir)
+	mustT(t, err)
+	dir, other := filepath.Join(tmpDir, "deploy"), filepath.Join(tmpDir, "other")
+	mustT(t, os.Mkdir(dir, 0755))
+	mustT(t, os.Mkdir(other, 0755))
+
+	n := NewNotifier(WithPolling(10 * time.Millisecond))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.WatchWith(dir, c, Create, Persistent()))
+	mustT(t, n.Watch(other, c, Create))
+
+	expect := func(e Event, path string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != e || ei.Path() != path {
+				t.Fatalf("want %v on %s; got %v", e, path, ei)
+			}
+		case <-time.After(timeout() + pollInterval):
+			t.Fatalf("timed out waiting for %v on %s", e, path)
+		}
+	}
+	mustT(t, os.Remove(other))
+	expect(Invalidated, other)
+	if err := n.Unwatch(other, c); !errors.Is(err, ErrNotWatched) {
+		t.Fatalf("want err=%v; got %v", ErrNotWatched, err)
+	}
+
+	mustT(t, os.Remove(dir))
+	expect(Invalidated, dir)
+	mustT(t, os.Mkdir(dir, 0755))
+	expect(Create, dir)
+	file := filepath.Join(dir, "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	expect(Create, file)
+}
+
+func TestNotifierAllowMissing(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, err := canonical(tmpDir)
+	mustT(t, err)
+	ready := filepath.Join(tmpDir, "run", "app", "ready")
+
+	n := NewNotifier(WithPolling(10 * time.Millisecond))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	if err := n.Watch(ready, c, Create); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("want err=%v; got %v", fs.ErrNotExist, err)
+	}
+	mustT(t, n.WatchWith(ready, c, Create, AllowMissing()))
+	other := filepath.Join(tmpDir, "other")
+	mustT(t, n.WatchWith(other, c, Create, AllowMissing()))
+	mustT(t, n.Unwatch(other, c))
+
+	expect := func(e Event, path string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != e || ei.Path() != path {
+				t.Fatalf("want %v on %s; got %v", e, path, ei)
+			}
+		case <-time.After(timeout() + pollInterval):
+			t.Fatalf("timed out waiting for %v on %s", e, path)
+		}
+	}
+	mustT(t, os.Mkdir(other, 0755))
+	mustT(t, os.MkdirAll(filepath.Dir(ready), 0755))
+	mustT(t, os.Mkdir(ready, 0755))
+	expect(Create, ready)
+	file := filepath.Join(ready, "file")
+	mustT(t, os.WriteFile(file, nil, 0644))
+	expect(Create, file)
+	mustT(t, n.Unwatch(ready, c))
+}
+
+func TestNotifierByName(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpDir, err := canonical(tmpDir)
+	mustT(t, err)
+	file := filepath.Join(tmpDir, "app.conf")
+	mustT(t, os.WriteFile(file, []byte("a"), 0644))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	s, err := n.Subscribe(file, c, Create|Write|Rename, ByName())
+	mustT(t, err)
+
+	// Save the file like editors do, writing a temporary file first.
+	tmp := filepath.Join(tmpDir, ".app.conf.swp")
+	mustT(t, os.WriteFile(tmp, []byte("b"), 0644))
+	mustT(t, os.Rename(tmp, file))
+	expect := func() {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Path() != file {
+				t.Fatalf("want event on %s; got %v", file, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for event on %s", file)
+		}
+	}
+	expect()
+	time.Sleep(50 * time.Millisecond)
+	for len(c) != 0 {
+		expect()
+	}
+	// The watchpoint follows the name, not the replaced file.
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	mustT(t, err)
+	_, err = f.WriteString("c")
+	mustT(t, err)
+	mustT(t, f.Close())
+	expect()
+
+	mustT(t, s.Close())
+	if wl := n.Watches(); len(wl) != 0 {
+		t.Fatalf("want no watches; got %v", wl)
+	}
+}
+
+func TestNotifierStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "a"), 0755))
+
+	n := NewNotifier()
+	defer n.Close()
+	c, full := make(chan EventInfo, 1), make(chan EventInfo)
+	mustT(t, n.Watch(filepath.Join(tmpDir, "..."), c, Create))
+	mustT(t, n.Watch(tmpDir, full, Create))
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "file"), nil, 0644))
+	select {
+	case <-c:
+	case <-time.After(timeout()):
+		t.Fatal("timed out before receiving event")
+	}
+
+	deadline := time.Now().Add(timeout())
+	st := n.Stats()
+	for (st.Read == 0 || st.Dropped == 0) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		st = n.Stats()
+	}
+	if st.Read != 1 || st.Dispatched != 1 || st.Sent != 1 || st.Dropped != 1 || st.Channels != 2 {
+		t.Fatalf("want Read=1, Dispatched=1, Sent=1, Dropped=1, Channels=2; got %+v", st)
+	}
+	if st.Watches != 2 || st.Nodes < 2 {
+		t.Fatalf("want Watches=2, Nodes>=2; got %+v", st)
+	}
+	if st.DispatchTime <= 0 || st.MaxDispatchTime > st.DispatchTime {
+		t.Fatalf("invalid dispatch times: %+v", st)
+	}
+	if s := n.Expvar().String(); !strings.Contains(s, `"Sent":1`) {
+		t.Fatalf("want expvar to report Sent=1; got %s", s)
+	}
+
+	// The channel watching parents of missing paths is not a user one.
+	missing := make(chan EventInfo, 1)
+	mustT(t, n.WatchWith(filepath.Join(tmpDir, "missing"), missing, Create, AllowMissing()))
+	if st := n.Stats(); st.Channels != 3 {
+		t.Fatalf("want Channels=3; got %+v", st)
+	}
+}
+
+func TestNotifierWatches(t *testing.T) {
+	tmpDir := t.TempDir()
+	mustT(t, os.MkdirAll(filepath.Join(tmpDir, "a", "b"), 0755))
+	tmpDir, err := filepath.EvalSymlinks(tmpDir)
+	mustT(t, err)
+
+	n := NewNotifier()
+	defer n.Close()
+	c1, c2 := make(chan EventInfo, 1), make(chan EventInfo, 1)
+	mustT(t, n.WatchWith(filepath.Join(tmpDir, "..."), c1, Create, Gitignore()))
+	mustT(t, n.Watch(filepath.Join(tmpDir, "a"), c1, Remove))
+	mustT(t, n.Watch(filepath.Join(tmpDir, "a"), c2, Write))
+	// Parents of missing paths and ignore files are watched internally.
+	mustT(t, n.WatchWith(filepath.Join(tmpDir, "missing", "file"), c2, Create, AllowMissing()))
+
+	// Native recursive watch of the parent covers the child, unless the
+	// watcher watches every directory separately.
+	rt, covered := n.tree.(*recursiveTree)
+	covered = covered && !rt.perdir
+	want := WatchList{
+		{Path: tmpDir, Events: Create, Recursive: true, Subscribers: 1, Kernel: true},
+		{Path: filepath.Join(tmpDir, "a"), Events: Remove | Write, Subscribers: 2, Kernel: !covered},
+	}
+	if wl := n.Watches(); !reflect.DeepEqual(wl, want) {
+		t.Fatalf("want %v; got %v", want, wl)
+	}
+	if s := n.Watches().String(); !strings.Contains(s, filepath.Join(tmpDir, "...")+": notify.Create") {
+		t.Fatalf("unexpected dump: %s", s)
+	}
+	p, err := json.Marshal(n.Watches())
+	mustT(t, err)
+	var dump []struct {
+		Path        string `json:"path"`
+		Events      string `json:"events"`
+		Subscribers int    `json:"subscribers"`
+	}
+	mustT(t, json.Unmarshal(p, &dump))
+	if len(dump) != 2 || dump[1].Subscribers != 2 ||
+		!strings.Contains(dump[1].Events, "notify.Remove") || !strings.Contains(dump[1].Events, "notify.Write") {
+		t.Fatalf("unexpected JSON dump: %s", p)
+	}
+
+	n.Stop(c1)
+	n.Stop(c2)
+	if wl := n.Watches(); len(wl) != 0 {
+		t.Fatalf("want no watches; got %v", wl)
+	}
+}
@@ -19,7 +19,10 @@
 
 package notify
 
-var defaultTree = newTree()
+import "expvar"
+
+// defaultNotifier is used by the package-level Watch and Stop functions.
+var defaultNotifier = NewNotifier()
 
 // Watch sets up a watchpoint on path listening for events given by the events
 // argument.
@@ -31,14 +34,22 @@ var defaultTree = newTree()
 // E.g. FSEvents reports a real path for every event, setting a watchpoint
 // on /tmp will report events with paths rooted at /private/tmp etc.
 //
+// Use WatchWith with the AllowMissing option in order to watch a path, which
+// does not exist yet. Once the path gets removed or moved away, the watchpoint
+// is removed with an Invalidated event, see Invalidated for the platforms it is
+// reported on. Use the Persistent option in order to have the watchpoint set
+// up again, once the path is back.
+//
 // The c almost always is a buffered channel. Watch will not block sending to c
 // - the caller must ensure that c has sufficient buffer space to keep up with
-// the expected event rate.
+// the expected event rate. Events which do not fit are dropped and accounted
+// by Dropped. Use WatchWith in order to configure a different delivery policy.
 //
 // It is allowed to pass the same channel multiple times with different event
 // list or different paths. Calling Watch with different event lists for a single
-// watchpoint expands its event set. The only way to shrink it, is to call
-// Stop on its channel.
+// watchpoint expands its event set. Use Unwatch in order to shrink it or remove
+// it, other watchpoints of the channel are left intact then. Stop removes all
+// watchpoints of the channel at once.
 //
 // Calling Watch with empty event list does not expand nor shrink watchpoint's
 // event set. If c is the first channel to listen for events on the given path,
@@ -61,14 +72,95 @@ var defaultTree = newTree()
 // e.g. use persistent paths like %userprofile% or watch additionally parent
 // directory of a recursive watchpoint in order to receive delete events for it.
 func Watch(path string, c chan<- EventInfo, events ...Event) error {
-	return defaultTree.Watch(path, c, events...)
+	return defaultNotifier.Watch(path, c, events...)
+}
+
+// WatchWith works like Watch, additionally configuring the watch with the given
+// options. The events argument is an event set joint using bitwise OR operator.
+//
+// The following example ensures no event is ever dropped for c, even if its
+// receiver is too slow to keep up with the event rate:
+//
+//	err := notify.WatchWith("./...", c, notify.All, notify.DeliverUnbounded())
+//
+// See (*Notifier).WatchWith for details.
+func WatchWith(path string, c chan<- EventInfo, events Event, opts ...WatchOption) error {
+	return defaultNotifier.WatchWith(path, c, events, opts...)
+}
+
+// Subscribe works like WatchWith, additionally returning a handle to the watch,
+// which allows for removing it without disturbing other watches of c:
+//
+//	a, err := notify.Subscribe("/a", c, notify.Write)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := notify.Watch("/b", c, notify.Write); err != nil {
+//	    log.Fatal(err)
+//	}
+//	a.Close() // c keeps receiving events for /b
+//
+// See (*Notifier).Subscribe for details.
+func Subscribe(path string, c chan<- EventInfo, events Event, opts ...WatchOption) (*Subscription, error) {
+	return defaultNotifier.Subscribe(path, c, events, opts...)
+}
+
+// Unwatch removes the events from the watchpoint registered for c on the path,
+// narrowing the underlying watch accordingly. The watchpoint is removed once it
+// has no events left, or when no events are given. Other watchpoints of c are
+// left intact:
+//
+//	if err := notify.Watch("/a/...", c, notify.Create, notify.Write); err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := notify.Unwatch("/a/...", c, notify.Write); err != nil {
+//	    log.Fatal(err) // c keeps receiving Create events for /a
+//	}
+//
+// The path must be given the same way it was given to Watch, i.e. recursive
+// watchpoints are removed with a path ending with "...", as recursive and
+// non-recursive watchpoints on the same path are independent of each other.
+// Unwatch fails with *WatchError if c has no watchpoint on the path.
+func Unwatch(path string, c chan<- EventInfo, events ...Event) error {
+	return defaultNotifier.Unwatch(path, c, events...)
+}
+
+// Dropped gives the number of events, which were dropped for c due to its
+// delivery policy.
+func Dropped(c chan<- EventInfo) uint64 {
+	return defaultNotifier.Dropped(c)
+}
+
+// Stats gives a snapshot of runtime statistics. See (*Notifier).Stats for
+// details.
+func Stats() Statistics {
+	return defaultNotifier.Stats()
+}
+
+// Expvar gives an expvar.Var, which reports runtime statistics as a JSON
+// object. It is meant to be published by the user:
+//
+//	expvar.Publish("notify", notify.Expvar())
+func Expvar() expvar.Var {
+	return defaultNotifier.Expvar()
 }
 
 // Stop removes all watchpoints registered for c. All underlying watches are
 // also removed, for which c was the last channel listening for events.
 //
-// Stop does not close c. When Stop returns, it is guaranteed that c will
-// receive no more signals.
+// Stop does not close c, unless c was watched with the CloseOnStop option.
+// When Stop returns, it is guaranteed that c will receive no more signals, so
+// it is safe to close c afterwards.
 func Stop(c chan<- EventInfo) {
-	defaultTree.Stop(c)
+	defaultNotifier.Stop(c)
+}
+
+// Errors returns a channel, which receives errors that happened asynchronously,
+// after the Watch or Stop call which caused them has returned. E.g. a failure
+// of setting a watch on a directory that was created within a recursive
+// watchpoint. Each error is of *WatchError type.
+//
+// Errors are dropped if the receiver does not keep up with receiving them.
+func Errors() <-chan error {
+	return defaultNotifier.Errors()
 }
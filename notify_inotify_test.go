@@ -7,7 +7,15 @@
 
 package notify
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
 
 func TestNotifySystemAndGlobalMix(t *testing.T) {
 	n := NewNotifyTest(t, "testdata/vfs.txt")
@@ -34,3 +42,330 @@ func TestUnknownEvent(t *testing.T) {
 
 	n.WatchErr("src/github.com/rjeczalik/fs", ch[0], nil, inExclUnlink)
 }
+
+func TestNotifyMove(t *testing.T) {
+	tmpDir := t.TempDir()
+	src, dst, out := filepath.Join(tmpDir, "src"), filepath.Join(tmpDir, "dst"), filepath.Join(tmpDir, "out")
+	for _, dir := range []string{src, dst, out} {
+		mustT(t, os.Mkdir(dir, 0755))
+	}
+	mustT(t, os.WriteFile(filepath.Join(src, "file"), []byte("abc"), 0644))
+	mustT(t, os.WriteFile(filepath.Join(src, "other"), []byte("abc"), 0644))
+
+	n := NewNotifier(WithMoveWindow(20 * time.Millisecond))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(src, c, Move))
+	mustT(t, n.Watch(dst, c, Move))
+
+	expect := func(e Event, path, old string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			mi, ok := ei.(MoveInfo)
+			if !ok {
+				t.Fatalf("want MoveInfo; got %T", ei)
+			}
+			if mi.Event() != e || mi.Path() != path {
+				t.Fatalf("want %v on %q; got %v", e, path, ei)
+			}
+			if mi.OldPath() != old {
+				t.Fatalf("want old path %q; got %q", old, mi.OldPath())
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for %v on %q", e, path)
+		}
+	}
+
+	mustT(t, os.Rename(filepath.Join(src, "file"), filepath.Join(dst, "file")))
+	expect(Move, filepath.Join(dst, "file"), filepath.Join(src, "file"))
+
+	mustT(t, os.Rename(filepath.Join(src, "other"), filepath.Join(out, "other")))
+	expect(Remove, filepath.Join(src, "other"), "")
+
+	mustT(t, os.Rename(filepath.Join(out, "other"), filepath.Join(dst, "other")))
+	expect(Create, filepath.Join(dst, "other"), "")
+}
+
+func TestNotifyRecursiveNested(t *testing.T) {
+	tmpDir := t.TempDir()
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 128)
+	mustT(t, n.Watch(filepath.Join(tmpDir, "..."), c, Create))
+
+	for i := 0; i < 10; i++ {
+		root := filepath.Join(tmpDir, "a"+strconv.Itoa(i))
+		file := filepath.Join(root, "b", "c", "file")
+		mustT(t, os.MkdirAll(filepath.Dir(file), 0755))
+		mustT(t, os.WriteFile(file, nil, 0644))
+
+		want := map[string]bool{
+			root:                          true,
+			filepath.Join(root, "b"):      true,
+			filepath.Join(root, "b", "c"): true,
+			file:                          true,
+		}
+		for len(want) != 0 {
+			select {
+			case ei := <-c:
+				if ei.Event() != Create {
+					t.Fatalf("want Create; got %v", ei)
+				}
+				delete(want, ei.Path())
+			case <-time.After(timeout()):
+				t.Fatalf("timed out waiting for Create events for %v", want)
+			}
+		}
+	}
+}
+
+func TestNotifyInvalidated(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir, rec, moved := filepath.Join(tmpDir, "dir"), filepath.Join(tmpDir, "rec"), filepath.Join(tmpDir, "moved")
+	mustT(t, os.Mkdir(dir, 0755))
+	mustT(t, os.MkdirAll(filepath.Join(rec, "sub"), 0755))
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(dir, c, Write))
+	mustT(t, n.Watch(filepath.Join(rec, "..."), c, Write))
+
+	expect := func(path string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != Invalidated || ei.Path() != path {
+				t.Fatalf("want Invalidated on %s; got %v", path, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for Invalidated on %s", path)
+		}
+	}
+	mustT(t, os.Remove(dir))
+	expect(dir)
+	mustT(t, os.Rename(rec, moved))
+	expect(rec)
+
+	deadline := time.Now().Add(timeout())
+	for n.Stats().Watches != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := n.Stats(); st.Watches != 0 || st.Channels != 1 {
+		t.Fatalf("want Watches=0, Channels=1; got %+v", st)
+	}
+	mustT(t, os.WriteFile(filepath.Join(moved, "sub", "file"), nil, 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyNonrecursiveParent(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	mustT(t, err)
+	a, b := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "a", "b")
+	for i := 0; i < 10; i++ {
+		mustT(t, os.MkdirAll(filepath.Join(b, "d"+strconv.Itoa(i), "x"), 0755))
+	}
+
+	n := NewNotifier()
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	watches := func(want int) {
+		t.Helper()
+		if st := n.Stats(); st.Watches != want {
+			t.Fatalf("want %d watches; got %+v", want, st)
+		}
+	}
+	kernel := func() {
+		t.Helper()
+		for _, wi := range n.Watches() {
+			if !wi.Kernel {
+				t.Fatalf("want %s to be watched by inotify; got %v", wi.Path, n.Watches())
+			}
+		}
+	}
+	created := func(path string) {
+		t.Helper()
+		mustT(t, os.WriteFile(filepath.Join(b, "d1", "x", "file"), nil, 0644))
+		mustT(t, os.WriteFile(path, nil, 0644))
+		select {
+		case ei := <-c:
+			if ei.Event() != Create || ei.Path() != path {
+				t.Fatalf("want Create on %s; got %v", path, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatal("timed out before receiving event")
+		}
+		mustT(t, os.Remove(filepath.Join(b, "d1", "x", "file")))
+	}
+
+	// Watching the parent after the child does not watch the whole subtree.
+	mustT(t, n.Watch(b, c, Create))
+	mustT(t, n.Watch(a, c, Create))
+	watches(2)
+	kernel()
+	created(filepath.Join(b, "file1"))
+
+	// Recursive watch of the parent takes over the child and hands it back
+	// once it is removed.
+	r := make(chan EventInfo, 64)
+	mustT(t, n.Watch(filepath.Join(a, "..."), r, Create))
+	watches(22)
+	mustT(t, n.Unwatch(filepath.Join(a, "..."), r))
+	watches(2)
+	kernel()
+	created(filepath.Join(b, "file2"))
+}
+
+func TestNotifySameDirectory(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	mustT(t, err)
+	sub := filepath.Join(tmpDir, "sub")
+	mustT(t, os.Mkdir(sub, 0755))
+
+	for _, recfirst := range []bool{false, true} {
+		n := NewNotifier()
+		c, r := make(chan EventInfo, 16), make(chan EventInfo, 16)
+		mustT(t, n.Watch(tmpDir, c, Create))
+		mustT(t, n.Watch(filepath.Join(tmpDir, "..."), r, Create))
+		watches := func(want int) {
+			t.Helper()
+			if st := n.Stats(); st.Watches != want {
+				t.Fatalf("want %d watches (recursive unwatched first: %t); got %+v", want, recfirst, st)
+			}
+			for _, wi := range n.Watches() {
+				if !wi.Kernel {
+					t.Fatalf("want %s to be watched by inotify; got %v", wi.Path, n.Watches())
+				}
+			}
+		}
+		created := func(path string, want ...chan EventInfo) {
+			t.Helper()
+			mustT(t, os.WriteFile(path, nil, 0644))
+			for _, ch := range want {
+				select {
+				case ei := <-ch:
+					if ei.Event() != Create || ei.Path() != path {
+						t.Fatalf("want Create on %s; got %v", path, ei)
+					}
+				case <-time.After(timeout()):
+					t.Fatalf("timed out before receiving Create on %s", path)
+				}
+			}
+			mustT(t, os.Remove(path))
+		}
+		quiet := func() {
+			t.Helper()
+			select {
+			case ei := <-c:
+				t.Fatalf("unexpected event: %v", ei)
+			case ei := <-r:
+				t.Fatalf("unexpected event: %v", ei)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		watches(2)
+		created(filepath.Join(tmpDir, "file1"), c, r)
+		created(filepath.Join(sub, "file1"), r)
+		quiet()
+		if recfirst {
+			mustT(t, n.Unwatch(filepath.Join(tmpDir, "..."), r))
+			watches(1)
+			created(filepath.Join(tmpDir, "file2"), c)
+			created(filepath.Join(sub, "file2"))
+			quiet()
+			mustT(t, n.Unwatch(tmpDir, c))
+		} else {
+			mustT(t, n.Unwatch(tmpDir, c))
+			watches(2)
+			created(filepath.Join(tmpDir, "file2"), r)
+			created(filepath.Join(sub, "file2"), r)
+			quiet()
+			mustT(t, n.Unwatch(filepath.Join(tmpDir, "..."), r))
+		}
+		watches(0)
+		created(filepath.Join(tmpDir, "file3"))
+		quiet()
+		mustT(t, n.Close())
+	}
+}
+
+func TestNotifyCollapseSaves(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file")
+	mustT(t, os.WriteFile(file, []byte("a"), 0644))
+
+	n := NewNotifier(WithOrdered(4))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(tmpDir, c, All))
+	saves := CollapseSaves(c, 50*time.Millisecond, nil)
+
+	// Save the file like sed -i does, renaming a temporary file over it.
+	tmp := filepath.Join(tmpDir, "sedX1b2c3")
+	mustT(t, os.WriteFile(tmp, []byte("b"), 0644))
+	mustT(t, os.Rename(tmp, file))
+	select {
+	case ei := <-saves:
+		if ei.Event() != Write || ei.Path() != file {
+			t.Fatalf("want Write on %q; got %v", file, ei)
+		}
+	case <-time.After(timeout()):
+		t.Fatal("timed out waiting for Write")
+	}
+	select {
+	case ei := <-saves:
+		t.Fatalf("want no more events; got %v", ei)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCollapseSavesCookies(t *testing.T) {
+	in := make(chan EventInfo)
+	c := CollapseSaves(in, time.Hour, nil)
+	defer close(in)
+
+	renamed := func(path string, mask, cookie uint32) *event {
+		e := Create
+		if mask == unix.IN_MOVED_FROM {
+			e = Rename
+		}
+		return &event{sys: unix.InotifyEvent{Mask: mask, Cookie: cookie}, path: path, event: e}
+	}
+	// The end of the move may be received first.
+	to := renamed("/a/file", unix.IN_MOVED_TO, 1)
+	in <- to
+	in <- &synthetic{e: Create, p: "/a/file.tmp"}
+	in <- renamed("/a/file.tmp", unix.IN_MOVED_FROM, 1)
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != to.Sys() {
+		t.Fatalf("want Write on /a/file; got %v", ei)
+	}
+
+	// Vim renames the file to a backup one, writes it anew and removes the
+	// backup.
+	in <- renamed("/a/file", unix.IN_MOVED_FROM, 2)
+	in <- renamed("/a/file~", unix.IN_MOVED_TO, 2)
+	in <- &synthetic{e: Create, p: "/a/file"}
+	in <- &synthetic{e: Write, p: "/a/file", sys: 3}
+	in <- &synthetic{e: Remove, p: "/a/file~"}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != 3 {
+		t.Fatalf("want Write on /a/file with sys=3; got %v", ei)
+	}
+
+	// Other moves are sent as they are, once both of their ends are received.
+	in <- renamed("/a/old", unix.IN_MOVED_FROM, 3)
+	in <- renamed("/a/new", unix.IN_MOVED_TO, 3)
+	for _, want := range []struct {
+		path string
+		e    Event
+	}{{"/a/old", Rename}, {"/a/new", Create}} {
+		if ei := receive(t, c); ei.Path() != want.path || ei.Event() != want.e {
+			t.Fatalf("want %v on %s; got %v", want.e, want.path, ei)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Persistent makes the watchpoint survive removal of its path. When the path is
+// removed or moved away, the channel receives an Invalidated event as usual,
+// but the watchpoint is set up again once the path is back, e.g. after
+// a deploy directory was recreated. Getting the watchpoint back is reported
+// with a Create event for the path, if the channel listens on it.
+//
+// While the path is gone, it is awaited like with AllowMissing. Events, which
+// happen between the removal of the path and setting up the watchpoint again,
+// are not reported.
+//
+// Unwatch and Stop called for the channel cancel the pending watchpoint.
+func Persistent() WatchOption {
+	return func(o *watchOptions) {
+		o.persist = true
+	}
+}
+
+// AllowMissing makes WatchWith accept a path, which does not exist yet, e.g.
+// in order to get notified once an application creates /var/run/app/ready.
+// Until the path appears, its nearest existing parent is watched instead,
+// following directories created on the way to the path. Once the path
+// appears, the watchpoint is set up on it and it becomes a regular one, which
+// is reported with a Create event for the path, if the channel listens on it.
+//
+// Events, which happen within the path before the watchpoint is set up, are
+// not reported. In case events of the parents are lost, the path is also
+// checked for every second.
+//
+// Unwatch and Stop called for the channel cancel the pending watchpoint. If the
+// path exists, AllowMissing has no effect.
+func AllowMissing() WatchOption {
+	return func(o *watchOptions) {
+		o.missing = true
+	}
+}
+
+// pending is a watchpoint waiting for its path to appear.
+type pending struct {
+	path   string // cleaned path of the watchpoint
+	isrec  bool   // whether the watchpoint is recursive
+	c      chan<- EventInfo
+	events Event
+	o      *watchOptions
+	anc    string // watched parent of the path, empty if none
+}
+
+// revival sets up pending watchpoints once their paths appear. Parents of the
+// paths are watched within the tree by its internal channel.
+type revival struct {
+	mu      sync.Mutex // protects all fields below, held while watching
+	pending []*pending
+	anc     map[string]int // number of pending watchpoints by watched parents
+	started bool           // whether the goroutine is running
+	closed  bool
+	// watch is WatchWith of the tree
+	watch func(string, chan<- EventInfo, *watchOptions, ...Event) error
+	// drop removes a watchpoint, keeping the channel registered
+	drop  func(path string, isrec bool, c chan<- EventInfo) error
+	sinks *sinks
+	c     chan EventInfo // internal channel watching parents
+	done  chan struct{}  // closed by close
+	wg    sync.WaitGroup // waits for the goroutine
+}
+
+func newRevival(watch func(string, chan<- EventInfo, *watchOptions, ...Event) error,
+	drop func(string, bool, chan<- EventInfo) error, s *sinks) *revival {
+	r := &revival{
+		anc:   make(map[string]int),
+		watch: watch,
+		drop:  drop,
+		sinks: s,
+		c:     make(chan EventInfo, buffer),
+		done:  make(chan struct{}),
+	}
+	s.Internal(r.c)
+	return r
+}
+
+// await makes the watchpoint on the missing path pending. It registers c
+// within the tree, so it can be stopped meanwhile.
+func (r *revival) await(path string, c chan<- EventInfo, o *watchOptions, events Event) error {
+	path, isrec, err := cleanpathgone(path)
+	if err != nil {
+		return err
+	}
+	if _, err := r.sinks.Add(c, o); err != nil {
+		return err
+	}
+	r.add(&pending{path: path, isrec: isrec, c: c, events: events, o: o})
+	return nil
+}
+
+// invalidate sends Invalidated event to every channel watching the path and
+// removes their watchpoints from the tree. Persistent watchpoints are kept
+// pending until the path is back.
+func (r *revival) invalidate(path string) {
+	for c, ss := range r.sinks.Watching(path) {
+		r.sinks.Send(delivery{c: c, ei: &synthetic{e: Invalidated, p: path}})
+		for _, s := range ss {
+			if err := r.drop(s.path, s.isrec, c); err != nil {
+				continue
+			}
+			if s.o != nil && s.o.persist {
+				r.add(&pending{path: s.path, isrec: s.isrec, c: c, events: s.events, o: s.o})
+			}
+		}
+	}
+}
+
+// add makes the watchpoint pending, unless its path has appeared meanwhile.
+func (r *revival) add(p *pending) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	debug("watchpoint pending", "path", p.path, chanattr(p.c))
+	if r.settle(p) {
+		return
+	}
+	r.pending = append(r.pending, p)
+	if !r.started {
+		r.started = true
+		r.wg.Add(1)
+		go r.loop()
+	}
+}
+
+// settle moves the watch of the parent of the pending watchpoint p down to
+// the nearest existing one and sets up the watchpoint, once its path exists.
+// It reports whether p is no longer pending. It expects r.mu to be locked.
+func (r *revival) settle(p *pending) bool {
+	for {
+		anc, err := nearest(p.path)
+		switch {
+		case err != nil:
+			return false
+		case anc == p.path:
+			return r.revive(p)
+		case anc == p.anc:
+			return false
+		}
+		// The parent is watched first, so directories created meanwhile are
+		// found by the next iteration.
+		if err := r.acquire(anc); err != nil {
+			debug("watching parent of pending watchpoint failed", "path", anc, "err", err)
+			return false
+		}
+		r.release(p.anc)
+		p.anc = anc
+	}
+}
+
+// revive sets up the pending watchpoint p, which path exists, and reports
+// whether it succeeded. It expects r.mu to be locked.
+func (r *revival) revive(p *pending) bool {
+	path := p.path
+	if p.isrec {
+		path = filepath.Join(path, "...")
+	}
+	// The parent is unwatched first, otherwise the tree could keep covering
+	// the path with the watch of the parent.
+	r.release(p.anc)
+	p.anc = ""
+	o := *p.o
+	o.missing = false
+	if err := r.watch(path, p.c, &o, p.events); err != nil {
+		debug("setting pending watchpoint failed", "path", p.path, chanattr(p.c), "err", err)
+		return false
+	}
+	if p.events&Create != 0 {
+		fi, err := os.Lstat(p.path)
+		r.sinks.Send(delivery{c: p.c, ei: &synthetic{e: Create, p: p.path, d: err == nil && fi.IsDir()}})
+	}
+	debug("pending watchpoint set", "path", p.path, chanattr(p.c))
+	return true
+}
+
+// acquire watches the parent of a pending watchpoint. It expects r.mu to be
+// locked.
+func (r *revival) acquire(anc string) error {
+	if r.anc[anc] == 0 {
+		if err := r.watch(anc, r.c, nil, Create); err != nil {
+			return err
+		}
+	}
+	r.anc[anc]++
+	return nil
+}
+
+// release unwatches the parent of a pending watchpoint, if no other one needs
+// it. It expects r.mu to be locked.
+func (r *revival) release(anc string) {
+	if anc == "" {
+		return
+	}
+	if r.anc[anc]--; r.anc[anc] > 0 {
+		return
+	}
+	delete(r.anc, anc)
+	// The parent may be gone already.
+	r.drop(anc, false, r.c)
+	if len(r.anc) == 0 {
+		r.sinks.Del(r.c)
+	}
+}
+
+// nearest gives the path, if it exists, or its nearest existing parent.
+func nearest(path string) (string, error) {
+	for {
+		_, err := os.Lstat(path)
+		switch {
+		case err == nil:
+			return path, nil
+		case !os.IsNotExist(err) || path == filepath.Dir(path):
+			return "", err
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// unwatch removes the events from the pending watchpoint of the given kind on
+// the path for c and reports whether it was found. The watchpoint is no
+// longer pending, once it has no events left.
+func (r *revival) unwatch(path string, isrec bool, c chan<- EventInfo, events Event) (ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancel(func(p *pending) bool {
+		if p.c != c || p.path != path || p.isrec != isrec {
+			return false
+		}
+		ok = true
+		p.events &^= events
+		return p.events == 0
+	})
+	return ok
+}
+
+// stopc removes all pending watchpoints for c.
+func (r *revival) stopc(c chan<- EventInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancel(func(p *pending) bool { return p.c == c })
+}
+
+// cancel removes the pending watchpoints, for which fn reports true, together
+// with the watches of their parents. It expects r.mu to be locked.
+func (r *revival) cancel(fn func(*pending) bool) {
+	r.filter(func(p *pending) bool {
+		if fn(p) {
+			r.release(p.anc)
+			return true
+		}
+		return false
+	})
+}
+
+// filter removes the pending watchpoints, for which fn reports true. It
+// expects r.mu to be locked.
+func (r *revival) filter(fn func(*pending) bool) {
+	n := 0
+	for _, p := range r.pending {
+		if !fn(p) {
+			r.pending[n] = p
+			n++
+		}
+	}
+	for i := n; i < len(r.pending); i++ {
+		r.pending[i] = nil
+	}
+	r.pending = r.pending[:n]
+}
+
+// loop settles pending watchpoints whenever their parents change, and every
+// second in case some of the events were lost, until the revival is closed.
+func (r *revival) loop() {
+	defer r.wg.Done()
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.c:
+		case <-t.C:
+		}
+		r.mu.Lock()
+		r.filter(r.settle)
+		r.mu.Unlock()
+	}
+}
+
+// close stops settling the pending watchpoints.
+func (r *revival) close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		r.pending = nil
+		close(r.done)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CollapseSaves recognises atomic saves among events received from in and
+// sends each of them to the returned channel as a single Write event of the
+// saved file. Recognised saves are:
+//
+//   - writing a temporary file and renaming it over the saved one, which is
+//     how sed -i and many editors save files,
+//   - renaming the saved file to a backup one, writing it anew and removing
+//     the backup, which is how vim saves files.
+//
+// Temporary and backup files are told by their names, e.g. sedXXXXXX, *.tmp,
+// file~ or vim's 4913. Events of a created temporary file are held back until
+// it gets renamed, or until no other event for it was received within the
+// window. A temporary file removed within the window is dropped along with its
+// events. Other created files are sent right away. Renames are held back until
+// the other end of the move is received and, if a file is renamed to a backup
+// one, until the backup is removed. Events, which were not collapsed, are sent
+// in the order they were received.
+//
+// A rename is matched with the path the file was moved to using Move events,
+// if the channel listens on them, or inotify cookies under Linux. On other
+// platforms atomic saves are recognised only if the watcher reports Move
+// events, e.g. the polling one. Events of a single path need to be received in
+// order, which requires the Notifier to be created with the WithOrdered option.
+//
+// The returned channel is closed after in gets closed and all held events are
+// sent. CollapseSaves never drops events, other than the ones of temporary
+// files, it buffers them until the receiver is ready instead. Closing done makes
+// it discard the events, which were not sent yet, and close the returned channel
+// right away. Nil done is never closed. It can be combined with Debounce:
+//
+//	n := notify.NewNotifier(notify.WithOrdered(4))
+//	c := make(chan notify.EventInfo, 1)
+//	if err := n.Watch("./...", c, notify.All); err != nil {
+//	    log.Fatal(err)
+//	}
+//	saves := notify.CollapseSaves(c, 100*time.Millisecond, nil)
+//	for ei := range notify.Debounce(saves, 100*time.Millisecond, time.Second, nil) {
+//	    log.Println("Got event:", ei)
+//	}
+func CollapseSaves(in <-chan EventInfo, window time.Duration, done <-chan struct{}) <-chan EventInfo {
+	s := &collapser{
+		in:      in,
+		c:       make(chan EventInfo),
+		done:    done,
+		window:  window,
+		held:    make(map[string]*held),
+		renamed: make(map[uint32]string),
+		backups: make(map[string]string),
+	}
+	go s.loop()
+	return s.c
+}
+
+// held are events of a path held back until it is known, whether they are part
+// of an atomic save. These are events of a created temporary file, a single
+// rename event waiting for the other end of its move, or events of a file
+// renamed to a backup one.
+type held struct {
+	path    string
+	events  []EventInfo
+	last    time.Time   // when the most recent event was received
+	temp    bool        // whether the file is a temporary one
+	cookie  uint32      // cookie of the rename of the file, 0 if not renamed yet
+	to      bool        // whether the file was moved to the path
+	backup  string      // path of the backup of the file, empty if none
+	written bool        // whether the file was written anew after its backup
+	removed bool        // whether the backup was removed
+	sys     interface{} // underlying data of the most recent write of the file
+}
+
+// collapser collapses atomic saves read from in and sends them to c.
+type collapser struct {
+	in      <-chan EventInfo
+	c       chan EventInfo
+	done    <-chan struct{}
+	window  time.Duration
+	held    map[string]*held  // held events by their paths
+	order   []*held           // held events in order they were received
+	renamed map[uint32]string // paths of held rename events by their cookies
+	backups map[string]string // paths of backed up files by their backups
+	ready   []EventInfo       // events to be sent to c, in order
+}
+
+// add records ei, either holding it back or making it ready to be sent.
+func (s *collapser) add(ei EventInfo, now time.Time) {
+	if e := ei.Event(); e == Overflow || e == Invalidated {
+		s.flushall()
+		s.ready = append(s.ready, ei)
+		return
+	}
+	path := ei.Path()
+	if mi, ok := ei.(MoveInfo); ok {
+		if old := mi.OldPath(); old != "" {
+			s.move(old, path, []EventInfo{ei}, ei.Sys(), now)
+			return
+		}
+	} else if cookie := movecookie(ei); cookie != 0 {
+		s.half(ei, cookie, now)
+		return
+	}
+	if saved, ok := s.backups[path]; ok && ei.Event()&Remove != 0 {
+		h := s.held[saved]
+		h.events = append(h.events, ei)
+		h.last, h.removed = now, true
+		s.saved(h)
+		return
+	}
+	if h, ok := s.held[path]; ok && h.cookie == 0 {
+		if h.temp && ei.Event()&Remove != 0 {
+			// The temporary file is gone before it was renamed.
+			s.drop(h)
+			return
+		}
+		h.events = append(h.events, ei)
+		h.last = now
+		if h.backup != "" && ei.Event()&(Create|Write) != 0 {
+			h.written, h.sys = true, ei.Sys()
+			s.saved(h)
+		}
+		return
+	}
+	s.flush(path)
+	if ei.Event()&Create != 0 && !isdir(ei) && istemp(path) {
+		s.hold(&held{path: path, events: []EventInfo{ei}, last: now, temp: true})
+		return
+	}
+	s.ready = append(s.ready, ei)
+}
+
+// half matches the rename event ei with the other end of its move. Both ends
+// may be received in any order, as events are dispatched concurrently.
+func (s *collapser) half(ei EventInfo, cookie uint32, now time.Time) {
+	path, to := ei.Path(), ei.Event()&Create != 0
+	other, ok := s.renamed[cookie]
+	if !ok {
+		if h, ok := s.held[path]; ok && h.cookie == 0 && h.temp && !to {
+			h.events = append(h.events, ei)
+			h.last, h.cookie = now, cookie
+		} else {
+			s.flush(path)
+			s.hold(&held{path: path, events: []EventInfo{ei}, last: now, cookie: cookie, to: to})
+		}
+		s.renamed[cookie] = path
+		return
+	}
+	h := s.held[other]
+	delete(s.renamed, cookie)
+	h.cookie = 0
+	switch {
+	case to && !h.to:
+		// The rename is the last held event of the file moved away.
+		from := h.events[len(h.events)-1]
+		if h.events = h.events[:len(h.events)-1]; len(h.events) == 0 {
+			s.drop(h)
+		}
+		s.move(other, path, []EventInfo{from, ei}, ei.Sys(), now)
+	case !to && h.to:
+		s.drop(h)
+		s.move(path, other, []EventInfo{h.events[0], ei}, h.events[0].Sys(), now)
+	default:
+		s.flush(other)
+		s.flush(path)
+		s.ready = append(s.ready, ei)
+	}
+}
+
+// move handles the move of the file from the old path to the new one, which
+// was reported with the given events. The sys is the underlying data of the
+// event reported for the new path.
+func (s *collapser) move(old, new string, events []EventInfo, sys interface{}, now time.Time) {
+	if h, ok := s.held[old]; ok && h.temp && h.cookie == 0 {
+		s.drop(h)
+		s.save(new, sys, now)
+		return
+	}
+	s.flush(old)
+	s.flush(new)
+	if isbackup(new) {
+		// The file may be written anew, before the backup is removed.
+		s.hold(&held{path: old, events: events, last: now, backup: new})
+		s.backups[new] = old
+		return
+	}
+	s.ready = append(s.ready, events...)
+}
+
+// save records a Write event of the file at the path, over which a temporary
+// file was renamed.
+func (s *collapser) save(path string, sys interface{}, now time.Time) {
+	ei := &synthetic{e: Write, p: path, sys: sys}
+	if h, ok := s.held[path]; ok && h.backup != "" && h.cookie == 0 {
+		h.events = append(h.events, ei)
+		h.last, h.written, h.sys = now, true, sys
+		s.saved(h)
+		return
+	}
+	s.flush(path)
+	s.ready = append(s.ready, ei)
+}
+
+// saved replaces the held events of the backed up file with a single Write
+// event, once the file was written anew and its backup removed.
+func (s *collapser) saved(h *held) {
+	if h.written && h.removed {
+		s.drop(h)
+		s.ready = append(s.ready, &synthetic{e: Write, p: h.path, sys: h.sys})
+	}
+}
+
+// hold holds back the events of h.
+func (s *collapser) hold(h *held) {
+	s.held[h.path] = h
+	s.order = append(s.order, h)
+}
+
+// drop removes the held events of h.
+func (s *collapser) drop(h *held) {
+	if h.cookie != 0 {
+		delete(s.renamed, h.cookie)
+	}
+	if h.backup != "" {
+		delete(s.backups, h.backup)
+	}
+	delete(s.held, h.path)
+}
+
+// flush moves the held events of the path, if any, to the ready ones.
+func (s *collapser) flush(path string) {
+	if h, ok := s.held[path]; ok {
+		s.drop(h)
+		s.ready = append(s.ready, h.events...)
+	}
+}
+
+// flushall moves all held events to the ready ones, in order they were
+// received.
+func (s *collapser) flushall() {
+	for _, h := range s.order {
+		if s.held[h.path] == h {
+			s.flush(h.path)
+		}
+	}
+	s.order = s.order[:0]
+}
+
+// flushdue moves the held events, which are due at now, to the ready ones in
+// order they were received and gives the time the next held events are due at.
+func (s *collapser) flushdue(now time.Time) (next time.Time) {
+	order := s.order[:0]
+	for _, h := range s.order {
+		if s.held[h.path] != h {
+			// Already sent or dropped.
+			continue
+		}
+		if due := h.last.Add(s.window); !due.After(now) {
+			s.flush(h.path)
+			continue
+		} else if next.IsZero() || due.Before(next) {
+			next = due
+		}
+		order = append(order, h)
+	}
+	for i := len(order); i < len(s.order); i++ {
+		s.order[i] = nil
+	}
+	s.order = order
+	return next
+}
+
+func (s *collapser) loop() {
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+		at      time.Time // when timer fires
+	)
+	for {
+		var (
+			c  chan<- EventInfo
+			ei EventInfo
+		)
+		if len(s.ready) != 0 {
+			c, ei = s.c, s.ready[0]
+		}
+		select {
+		case e, ok := <-s.in:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				s.flushall()
+				s.close()
+				return
+			}
+			s.add(e, time.Now())
+		case c <- ei:
+			s.ready[0] = nil
+			s.ready = s.ready[1:]
+		case <-s.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			close(s.c)
+			return
+		case <-timeout:
+			timer, timeout, at = nil, nil, time.Time{}
+		}
+		next := s.flushdue(time.Now())
+		if !next.Equal(at) {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer, timeout, at = nil, nil, next
+			if !next.IsZero() {
+				timer = time.NewTimer(time.Until(next))
+				timeout = timer.C
+			}
+		}
+	}
+}
+
+// close sends the ready events and closes c. It gives up sending once done
+// gets closed.
+func (s *collapser) close() {
+	defer close(s.c)
+	for _, ei := range s.ready {
+		select {
+		case s.c <- ei:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// isdir reports whether ei is known to describe a directory.
+func isdir(ei EventInfo) bool {
+	if d, ok := ei.(isDirer); ok {
+		isdir, _ := d.isDir()
+		return isdir
+	}
+	return false
+}
+
+// istemp reports whether the name of the file at the path is the one editors
+// and tools give to temporary or backup files, while saving files.
+func istemp(path string) bool {
+	name := base(path)
+	switch {
+	case isbackup(path),
+		strings.HasPrefix(name, "sed") && len(name) == 9, // sed -i
+		strings.Contains(name, ".tmp"),
+		strings.HasSuffix(name, ".temp"),
+		strings.HasPrefix(name, ".goutputstream-"), // GLib
+		strings.HasSuffix(name, "___jb_tmp___"),    // JetBrains IDEs
+		isprobe(name):
+		return true
+	}
+	return false
+}
+
+// isbackup reports whether the name of the file at the path is the one editors
+// give to backups of saved files.
+func isbackup(path string) bool {
+	name := base(path)
+	return strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".bak") ||
+		strings.HasSuffix(name, "___jb_old___")
+}
+
+// isprobe reports whether the name is the one of files vim creates in order to
+// check whether it can write to a directory: 4913, 5036, 5159 and so on.
+func isprobe(name string) bool {
+	if name == "" || name[0] < '0' || name[0] > '9' {
+		return false
+	}
+	n, err := strconv.Atoi(name)
+	return err == nil && n >= 4913 && (n-4913)%123 == 0
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package notify
+
+import "golang.org/x/sys/unix"
+
+// movecookie gives the inotify cookie, which associates both rename events of
+// a single move, or 0 if ei is not such an event.
+func movecookie(ei EventInfo) uint32 {
+	if sys, ok := ei.Sys().(*unix.InotifyEvent); ok && sys.Mask&(unix.IN_MOVED_FROM|unix.IN_MOVED_TO) != 0 {
+		return sys.Cookie
+	}
+	return 0
+}
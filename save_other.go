@@ -0,0 +1,13 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package notify
+
+// movecookie gives 0, the platform does not associate rename events.
+func movecookie(EventInfo) uint32 {
+	return 0
+}
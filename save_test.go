@@ -0,0 +1,135 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollapseSaves(t *testing.T) {
+	in := make(chan EventInfo)
+	c := CollapseSaves(in, 50*time.Millisecond, nil)
+
+	in <- &synthetic{e: Create, p: "/a/.file.tmp"}
+	in <- &synthetic{e: Write, p: "/a/.file.tmp"}
+	in <- &moved{e: Move, p: "/a/file", old: "/a/.file.tmp", sys: 1}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != 1 {
+		t.Fatalf("want Write on /a/file with sys=1; got %v", ei)
+	}
+
+	in <- &synthetic{e: Create, p: "/a/new"}
+	if ei := receive(t, c); ei.Path() != "/a/new" || ei.Event() != Create {
+		t.Fatalf("want Create on /a/new to be sent right away; got %v", ei)
+	}
+	in <- &synthetic{e: Create, p: "/a/sedX1b2c3"}
+	in <- &synthetic{e: Write, p: "/a/file"}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write {
+		t.Fatalf("want Write on /a/file to be sent right away; got %v", ei)
+	}
+	in <- &synthetic{e: Write, p: "/a/sedX1b2c3"}
+	for _, e := range []Event{Create, Write} {
+		if ei := receive(t, c); ei.Path() != "/a/sedX1b2c3" || ei.Event() != e {
+			t.Fatalf("want %v on /a/sedX1b2c3 after the window; got %v", e, ei)
+		}
+	}
+
+	in <- &synthetic{e: Create, p: "/a/dir.tmp", d: true}
+	if ei := receive(t, c); ei.Path() != "/a/dir.tmp" {
+		t.Fatalf("want Create on /a/dir.tmp to be sent right away; got %v", ei)
+	}
+	in <- &synthetic{e: Create, p: "/a/x.tmp"}
+	in <- &moved{e: Move, p: "/a/y", old: "/a/z"}
+	if ei := receive(t, c); ei.Path() != "/a/y" || ei.Event() != Move {
+		t.Fatalf("want Move on /a/y; got %v", ei)
+	}
+	close(in)
+	if ei := receive(t, c); ei.Path() != "/a/x.tmp" || ei.Event() != Create {
+		t.Fatalf("want held event to be flushed on close; got %v", ei)
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("want channel to be closed")
+	}
+}
+
+func TestCollapseSavesBackup(t *testing.T) {
+	in := make(chan EventInfo)
+	c := CollapseSaves(in, time.Hour, nil)
+
+	// Vim checks whether it can write to the directory first.
+	in <- &synthetic{e: Create, p: "/a/4913"}
+	in <- &synthetic{e: Remove, p: "/a/4913"}
+	in <- &moved{e: Move, p: "/a/file~", old: "/a/file"}
+	in <- &synthetic{e: Create, p: "/a/file"}
+	in <- &synthetic{e: Write, p: "/a/file", sys: 1}
+	in <- &synthetic{e: Remove, p: "/a/file~"}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != 1 {
+		t.Fatalf("want Write on /a/file with sys=1; got %v", ei)
+	}
+
+	// Events of different paths may be received out of order.
+	in <- &moved{e: Move, p: "/a/file~", old: "/a/file"}
+	in <- &synthetic{e: Remove, p: "/a/file~"}
+	in <- &synthetic{e: Create, p: "/a/file", sys: 2}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != 2 {
+		t.Fatalf("want Write on /a/file with sys=2; got %v", ei)
+	}
+
+	// The backup may be written by renaming a temporary file over the file.
+	in <- &moved{e: Move, p: "/a/file.bak", old: "/a/file"}
+	in <- &synthetic{e: Create, p: "/a/file.tmp"}
+	in <- &moved{e: Move, p: "/a/file", old: "/a/file.tmp", sys: 3}
+	in <- &synthetic{e: Remove, p: "/a/file.bak"}
+	if ei := receive(t, c); ei.Path() != "/a/file" || ei.Event() != Write || ei.Sys() != 3 {
+		t.Fatalf("want Write on /a/file with sys=3; got %v", ei)
+	}
+
+	// Backups, which are kept, are sent as they are.
+	in <- &moved{e: Move, p: "/a/other~", old: "/a/other"}
+	in <- &synthetic{e: Create, p: "/a/other"}
+	close(in)
+	if ei := receive(t, c); ei.Path() != "/a/other~" || ei.Event() != Move {
+		t.Fatalf("want Move on /a/other~; got %v", ei)
+	}
+	if ei := receive(t, c); ei.Path() != "/a/other" || ei.Event() != Create {
+		t.Fatalf("want Create on /a/other; got %v", ei)
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("want channel to be closed")
+	}
+}
+
+func TestCollapseSavesOrder(t *testing.T) {
+	in := make(chan EventInfo)
+	c := CollapseSaves(in, 50*time.Millisecond, nil)
+	defer close(in)
+
+	paths := []string{"/a/3.tmp", "/a/1.tmp", "/a/4.tmp", "/a/2.tmp", "/a/0.tmp"}
+	for _, path := range paths {
+		in <- &synthetic{e: Create, p: path}
+	}
+	for _, path := range paths {
+		if ei := receive(t, c); ei.Path() != path {
+			t.Fatalf("want Create on %s; got %v", path, ei)
+		}
+	}
+}
+
+func TestCollapseSavesDone(t *testing.T) {
+	in := make(chan EventInfo)
+	done := make(chan struct{})
+	c := CollapseSaves(in, time.Hour, done)
+
+	in <- &synthetic{e: Create, p: "/a/x.tmp"}
+	close(done)
+	select {
+	case ei, ok := <-c:
+		if ok {
+			t.Fatalf("want held event to be discarded; got %v", ei)
+		}
+	case <-time.After(timeout()):
+		t.Fatal("want channel to be closed after done is closed")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Statistics is a snapshot of runtime statistics of a Notifier. Counters are
+// cumulative, they are never reset.
+type Statistics struct {
+	// Watches is the number of watches held by the underlying watcher, e.g.
+	// inotify watch descriptors, or -1 if the watcher does not tell it.
+	Watches int
+
+	// Nodes is the number of nodes in the watchpoint tree, which includes the
+	// watched paths, their parents and, on platforms which emulate recursive
+	// watchpoints, all directories within them.
+	Nodes int
+
+	// Channels is the number of registered user channels. Channels used by
+	// notify internally are not counted.
+	Channels int
+
+	// Read is the number of events the underlying watcher read from the OS,
+	// before they were paired, filtered or dispatched, or zero if the watcher
+	// does not tell it.
+	Read uint64
+
+	// Dispatched is the number of events dispatched to the watchpoint tree.
+	// Events, which were read but not dispatched, were paired into Move events
+	// or filtered out by the watcher. A dispatched event is sent to every
+	// channel watching its path, it is not sent at all if none does.
+	Dispatched uint64
+
+	// Sent is the number of events sent to user channels.
+	Sent uint64
+
+	// Dropped is the number of events dropped due to delivery policies, or
+	// because of full internal buffers.
+	Dropped uint64
+
+	// Overflows is the number of Overflow events reported by the underlying
+	// watcher.
+	Overflows uint64
+
+	// DispatchTime is the total time spent on dispatching events, including
+	// time spent waiting for channels with the Block delivery policy.
+	DispatchTime time.Duration
+
+	// MaxDispatchTime is the longest time spent on dispatching a single event.
+	MaxDispatchTime time.Duration
+}
+
+// counters holds the statistics maintained by a tree.
+type counters struct {
+	events    atomic.Uint64 // number of dispatched events
+	overflows atomic.Uint64
+	dispatch  atomic.Uint64 // nanoseconds
+	maxdisp   atomic.Uint64 // nanoseconds
+	sw        statWatcher   // nil if the watcher does not tell what it watches
+}
+
+// dispatched records an event, which dispatch started at start.
+func (c *counters) dispatched(ei EventInfo, start time.Time) {
+	d := uint64(time.Since(start))
+	c.events.Add(1)
+	if ei.Event() == Overflow {
+		c.overflows.Add(1)
+	}
+	c.dispatch.Add(d)
+	for max := c.maxdisp.Load(); d > max; max = c.maxdisp.Load() {
+		if c.maxdisp.CompareAndSwap(max, d) {
+			break
+		}
+	}
+}
+
+// stats gives a snapshot of the counters, filling the given number of tree
+// nodes and statistics of the sinks. It expects the tree to be locked.
+func (c *counters) stats(nodes int, s *sinks) Statistics {
+	st := Statistics{
+		Watches:         -1,
+		Nodes:           nodes,
+		Dispatched:      c.events.Load(),
+		Overflows:       c.overflows.Load(),
+		DispatchTime:    time.Duration(c.dispatch.Load()),
+		MaxDispatchTime: time.Duration(c.maxdisp.Load()),
+	}
+	if c.sw != nil {
+		st.Watches = c.sw.Watches()
+		st.Read = c.sw.Read()
+	}
+	st.Channels, st.Sent, st.Dropped = s.Stats()
+	return st
+}
+
+// watched reports whether the watcher holds a watch for the path. It reports
+// true if the watcher does not tell it. It expects the tree to be locked.
+func (c *counters) watched(path string) bool {
+	return c.sw == nil || c.sw.Watched(path)
+}
+
+// countnodes gives the number of nodes in the tree rooted at nd, excluding nd.
+func countnodes(nd node) (n int) {
+	nd.Walk(func(node) error {
+		n++
+		return nil
+	})
+	return n - 1
+}
+
+// Expvar gives an expvar.Var, which reports the statistics of the Notifier n
+// as a JSON object. It is meant to be published by the user:
+//
+//	expvar.Publish("notify", n.Expvar())
+func (n *Notifier) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return n.Stats()
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+// Subscription is a handle to a single watch set up by Subscribe. Closing it
+// removes the events it was set up with from the watchpoint on its path, while
+// other watches using the same channel are left intact.
+//
+// It is safe to use Subscription from multiple goroutines.
+type Subscription struct {
+	n      *Notifier
+	c      chan<- EventInfo
+	path   string
+	isrec  bool
+	events Event
+	cmu    sync.Mutex // serializes Close, protects closed
+	closed bool
+	mu     sync.Mutex // protects err
+	err    error
+}
+
+// Subscribe works like WatchWith, additionally returning a handle to the watch,
+// which allows for removing it without disturbing other watches of c. Errors,
+// which happen asynchronously for paths within the watch, are reported by the
+// Err method of the handle, besides the Errors channel.
+//
+// Subscriptions which share channel and path share the watch as well. Closing
+// one of them removes only the events, which no other open subscription of the
+// watch listens on.
+func (n *Notifier) Subscribe(path string, c chan<- EventInfo, events Event, opts ...WatchOption) (*Subscription, error) {
+	n.subs.mu.Lock()
+	defer n.subs.mu.Unlock()
+	if err := n.WatchWith(path, c, events, opts...); err != nil {
+		return nil, err
+	}
+	// Paths watched with AllowMissing or ByName may not exist.
+	path, isrec, err := cleanpathgone(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{
+		n:      n,
+		c:      c,
+		path:   path,
+		isrec:  isrec,
+		events: events &^ (Overflow | Invalidated),
+	}
+	n.subs.add(s)
+	return s, nil
+}
+
+// Path gives the absolute, cleaned path of the watch. For recursive watches it
+// does not contain the trailing "...".
+func (s *Subscription) Path() string {
+	return s.path
+}
+
+// Recursive reports whether the watch is recursive.
+func (s *Subscription) Recursive() bool {
+	return s.isrec
+}
+
+// Events gives the events the watch was set up with.
+func (s *Subscription) Events() Event {
+	return s.events
+}
+
+// Err gives the most recent error of the watch, which is either the one returned
+// by Close or the one, which happened asynchronously for a path within the
+// watch, e.g. a failure of watching a directory created within a recursive
+// watch. It is nil if no error happened.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close removes the watch. It does not close the channel, unless the channel
+// was watched with the CloseOnStop option and the watch was its last one. It
+// does not fail if the watch was already removed, e.g. by Stop or by closing the
+// Notifier. Calling Close more than once is a nop.
+func (s *Subscription) Close() error {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	if s.closed {
+		return s.Err()
+	}
+	s.closed = true
+	s.n.subs.mu.Lock()
+	defer s.n.subs.mu.Unlock()
+	events := s.n.subs.del(s)
+	if events == 0 {
+		return nil
+	}
+	path := s.path
+	if s.isrec {
+		path = filepath.Join(path, "...")
+	}
+	err := s.n.Unwatch(path, s.c, events)
+	if err == nil || errors.Is(err, ErrClosed) || errors.Is(err, ErrNotWatched) {
+		return nil
+	}
+	s.seterr(err)
+	return err
+}
+
+// seterr records err as the most recent error of the watch.
+func (s *Subscription) seterr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// covers reports whether the path is within the watch.
+func (s *Subscription) covers(path string) bool {
+	return path == s.path || s.isrec && indexrel(s.path, path) != -1
+}
+
+// subkey identifies a watch, which may be shared by subscriptions.
+type subkey struct {
+	c     chan<- EventInfo
+	path  string
+	isrec bool
+}
+
+// subscriptions are the open subscriptions of a Notifier by their watches.
+type subscriptions struct {
+	// mu is held while setting up and removing watches of subscriptions, so
+	// the events of a watch match the ones of its subscriptions. It is locked
+	// before the Notifier's one.
+	mu sync.Mutex
+	rw sync.RWMutex // protects m
+	m  map[subkey]map[*Subscription]struct{}
+}
+
+// add registers the subscription s. It expects ss.mu to be locked.
+func (ss *subscriptions) add(s *Subscription) {
+	ss.rw.Lock()
+	defer ss.rw.Unlock()
+	if ss.m == nil {
+		ss.m = make(map[subkey]map[*Subscription]struct{})
+	}
+	k := subkey{c: s.c, path: s.path, isrec: s.isrec}
+	if ss.m[k] == nil {
+		ss.m[k] = make(map[*Subscription]struct{})
+	}
+	ss.m[k][s] = struct{}{}
+}
+
+// del unregisters the subscription s and gives its events, which no other
+// subscription of the watch listens on. It expects ss.mu to be locked.
+func (ss *subscriptions) del(s *Subscription) Event {
+	ss.rw.Lock()
+	defer ss.rw.Unlock()
+	k := subkey{c: s.c, path: s.path, isrec: s.isrec}
+	if _, ok := ss.m[k][s]; !ok {
+		// The subscription was stopped already, the watch of its path, if
+		// any, belongs to another one.
+		return 0
+	}
+	subs := ss.m[k]
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(ss.m, k)
+	}
+	events := s.events
+	for other := range subs {
+		events &^= other.events
+	}
+	return events
+}
+
+// stop unregisters all subscriptions of c. It expects ss.mu to be locked.
+func (ss *subscriptions) stop(c chan<- EventInfo) {
+	ss.rw.Lock()
+	defer ss.rw.Unlock()
+	for k := range ss.m {
+		if k.c == c {
+			delete(ss.m, k)
+		}
+	}
+}
+
+// report records err for the subscriptions, whose watches contain the path of
+// err. Errors, which are not of *WatchError type or have no path, are ignored.
+func (ss *subscriptions) report(err error) {
+	var werr *WatchError
+	if !errors.As(err, &werr) || werr.Path == "" {
+		return
+	}
+	ss.rw.RLock()
+	defer ss.rw.RUnlock()
+	for _, subs := range ss.m {
+		for s := range subs {
+			if s.covers(werr.Path) {
+				s.seterr(err)
+			}
+		}
+	}
+}
@@ -22,7 +22,7 @@ func Sync() {
 	// to hack it.
 	// r, _, err := procSetSystemFileCacheSize.Call(none, none, 0)
 	// if r == 0 {
-	//   dbgprint("SetSystemFileCacheSize error:", err)
+	//   debug("SetSystemFileCacheSize error", "err", err)
 	// }
 }
 
@@ -120,6 +120,11 @@ func tmptree(root, list string) (string, error) {
 	return root, nil
 }
 
+// debugf logs formatted message at the Debug level.
+func debugf(format string, v ...interface{}) {
+	debug(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
 func callern(n int) string {
 	_, file, line, ok := runtime.Caller(n)
 	if !ok {
@@ -352,9 +357,9 @@ func create(w *W, path string) WCase {
 				w.Fatalf("tmpcreate(%q, %q)=%v", w.root, path, err)
 			}
 			if isdir {
-				dbgprintf("[FS] os.Mkdir(%q)\n", path)
+				debugf("[FS] os.Mkdir(%q)\n", path)
 			} else {
-				dbgprintf("[FS] os.Create(%q)\n", path)
+				debugf("[FS] os.Create(%q)\n", path)
 			}
 		},
 		Events: []EventInfo{
@@ -369,7 +374,7 @@ func remove(w *W, path string) WCase {
 			if err := os.RemoveAll(filepath.Join(w.root, filepath.FromSlash(path))); err != nil {
 				w.Fatal(err)
 			}
-			dbgprintf("[FS] os.Remove(%q)\n", path)
+			debugf("[FS] os.Remove(%q)\n", path)
 		},
 		Events: []EventInfo{
 			&Call{P: path, E: Remove},
@@ -385,7 +390,7 @@ func rename(w *W, oldpath, newpath string) WCase {
 			if err != nil {
 				w.Fatal(err)
 			}
-			dbgprintf("[FS] os.Rename(%q, %q)\n", oldpath, newpath)
+			debugf("[FS] os.Rename(%q, %q)\n", oldpath, newpath)
 		},
 		Events: []EventInfo{
 			&Call{P: newpath, E: Rename},
@@ -407,7 +412,7 @@ func write(w *W, path string, p []byte) WCase {
 			if err := nonil(f.Sync(), f.Close()); err != nil {
 				w.Fatalf("Sync(%q)/Close(%q)=%v", path, path, err)
 			}
-			dbgprintf("[FS] Write(%q)\n", path)
+			debugf("[FS] Write(%q)\n", path)
 		},
 		Events: []EventInfo{
 			&Call{P: path, E: Write},
@@ -434,7 +439,7 @@ func (w *W) ExpectAnyFunc(cases []WCase, fn WCaseFunc) {
 	UpdateWait() // Wait some time before starting the test.
 Test:
 	for i, cas := range cases {
-		dbgprintf("ExpectAny: i=%d\n", i)
+		debugf("ExpectAny: i=%d\n", i)
 		cas.Action()
 		Sync()
 		switch cas.Events {
@@ -445,11 +450,11 @@ Test:
 		default:
 			select {
 			case ei := <-w.C:
-				dbgprintf("received: path=%q, event=%v, sys=%v (i=%d)", ei.Path(),
+				debugf("received: path=%q, event=%v, sys=%v (i=%d)", ei.Path(),
 					ei.Event(), ei.Sys(), i)
 				for j, want := range cas.Events {
 					if err := EqualEventInfo(want, ei); err != nil {
-						dbgprint(err, j)
+						debug(fmt.Sprint(err, j))
 						continue
 					}
 					if fn != nil {
@@ -491,7 +496,7 @@ func (w *W) ExpectAllFunc(cases []WCase) {
 	UpdateWait() // Wait some time before starting the test.
 	for i, cas := range cases {
 		exp := w.aggregate(cas.Events, w.root)
-		dbgprintf("ExpectAll: i=%d\n", i)
+		debugf("ExpectAll: i=%d\n", i)
 		cas.Action()
 		Sync()
 		got := w.aggregate(drainall(w.C), "")
@@ -619,37 +624,37 @@ type Spy []Call
 func (s *Spy) Close() (_ error) { return }
 
 func (s *Spy) Watch(p string, e Event) (_ error) {
-	dbgprintf("%s: (*Spy).Watch(%q, %v)", caller(), p, e)
+	debugf("%s: (*Spy).Watch(%q, %v)", caller(), p, e)
 	*s = append(*s, Call{F: FuncWatch, P: p, E: e})
 	return
 }
 
 func (s *Spy) Unwatch(p string) (_ error) {
-	dbgprintf("%s: (*Spy).Unwatch(%q)", caller(), p)
+	debugf("%s: (*Spy).Unwatch(%q)", caller(), p)
 	*s = append(*s, Call{F: FuncUnwatch, P: p})
 	return
 }
 
 func (s *Spy) Rewatch(p string, olde, newe Event) (_ error) {
-	dbgprintf("%s: (*Spy).Rewatch(%q, %v, %v)", caller(), p, olde, newe)
+	debugf("%s: (*Spy).Rewatch(%q, %v, %v)", caller(), p, olde, newe)
 	*s = append(*s, Call{F: FuncRewatch, P: p, E: olde, NE: newe})
 	return
 }
 
 func (s *Spy) RecursiveWatch(p string, e Event) (_ error) {
-	dbgprintf("%s: (*Spy).RecursiveWatch(%q, %v)", caller(), p, e)
+	debugf("%s: (*Spy).RecursiveWatch(%q, %v)", caller(), p, e)
 	*s = append(*s, Call{F: FuncRecursiveWatch, P: p, E: e})
 	return
 }
 
 func (s *Spy) RecursiveUnwatch(p string) (_ error) {
-	dbgprintf("%s: (*Spy).RecursiveUnwatch(%q)", caller(), p)
+	debugf("%s: (*Spy).RecursiveUnwatch(%q)", caller(), p)
 	*s = append(*s, Call{F: FuncRecursiveUnwatch, P: p})
 	return
 }
 
 func (s *Spy) RecursiveRewatch(oldp, newp string, olde, newe Event) (_ error) {
-	dbgprintf("%s: (*Spy).RecursiveRewatch(%q, %q, %v, %v)", caller(), oldp, newp, olde, newe)
+	debugf("%s: (*Spy).RecursiveRewatch(%q, %q, %v, %v)", caller(), oldp, newp, olde, newe)
 	*s = append(*s, Call{F: FuncRecursiveRewatch, P: oldp, NP: newp, E: olde, NE: newe})
 	return
 }
@@ -708,9 +713,9 @@ func newTreeN(t *testing.T, tree string) *N {
 func NewNotifyTest(t *testing.T, tree string) *N {
 	n := newN(t, tree)
 	if rw, ok := n.w.watcher().(recursiveWatcher); ok {
-		n.tree = newRecursiveTree(rw, n.w.c())
+		n.tree = newRecursiveTree(rw, n.w.c(), 0)
 	} else {
-		n.tree = newNonrecursiveTree(n.w.watcher(), n.w.c(), nil)
+		n.tree = newNonrecursiveTree(n.w.watcher(), n.w.c(), nil, 0)
 	}
 	t.Cleanup(n.Close)
 	return n
@@ -718,14 +723,14 @@ func NewNotifyTest(t *testing.T, tree string) *N {
 
 func NewRecursiveTreeTest(t *testing.T, tree string) *N {
 	n := newTreeN(t, tree)
-	n.tree = newRecursiveTree(n.spy, n.c)
+	n.tree = newRecursiveTree(n.spy, n.c, 0)
 	t.Cleanup(n.Close)
 	return n
 }
 
 func NewNonrecursiveTreeTest(t *testing.T, tree string) *N {
 	n := newTreeN(t, tree)
-	n.tree = newNonrecursiveTree(n.spy, n.c, nil)
+	n.tree = newNonrecursiveTree(n.spy, n.c, nil, 0)
 	t.Cleanup(n.Close)
 	return n
 }
@@ -749,7 +754,7 @@ func NewNonrecursiveTreeTestC(t *testing.T, tree string) (*N, chan EventInfo) {
 		}
 	}()
 	n := newTreeN(t, tree)
-	tr := newNonrecursiveTree(n.spy, n.c, recinternal)
+	tr := newNonrecursiveTree(n.spy, n.c, recinternal, 0)
 	tr.rec = rec
 	n.tree = tr
 	t.Cleanup(n.Close)
@@ -793,6 +798,13 @@ func (n *N) WatchErr(path string, c chan<- EventInfo, err error, events ...Event
 	}
 }
 
+func (n *N) Unwatch(path string, c chan<- EventInfo, events Event) {
+	path = filepath.Join(n.w.root, path)
+	if err := n.tree.Unwatch(path, c, events); err != nil {
+		n.t.Errorf("Unwatch(%s, %p, %v)=%v", path, c, events, err)
+	}
+}
+
 func (n *N) Stop(c chan<- EventInfo) {
 	n.tree.Stop(c)
 }
@@ -802,6 +814,8 @@ func (n *N) Call(calls ...Call) {
 		switch calls[i].F {
 		case FuncWatch:
 			n.Watch(calls[i].P, calls[i].C, calls[i].E)
+		case FuncUnwatch:
+			n.Unwatch(calls[i].P, calls[i].C, calls[i].E)
 		case FuncStop:
 			n.Stop(calls[i].C)
 		default:
@@ -818,7 +832,7 @@ func (n *N) expectDry(ch Chans, i int) {
 
 func (n *N) ExpectRecordedCalls(cases []RCase) {
 	for i, cas := range cases {
-		dbgprintf("ExpectRecordedCalls: i=%d\n", i)
+		debugf("ExpectRecordedCalls: i=%d\n", i)
 		n.Call(cas.Call)
 		record := (*n.spy)[n.j:]
 		if len(cas.Record) == 0 && len(record) == 0 {
@@ -879,7 +893,7 @@ func (n *N) abs(rel Call) *Call {
 
 func (n *N) ExpectTreeEvents(cases []TCase, all Chans) {
 	for i, cas := range cases {
-		dbgprintf("ExpectTreeEvents: i=%d\n", i)
+		debugf("ExpectTreeEvents: i=%d\n", i)
 		// Ensure there're no dangling event left by previous test-case.
 		n.expectDry(all, i)
 		n.c <- n.abs(cas.Event)
@@ -908,7 +922,7 @@ func (n *N) ExpectTreeEvents(cases []TCase, all Chans) {
 func (n *N) ExpectNotifyEvents(cases []NCase, all Chans) {
 	UpdateWait() // Wait some time before starting the test.
 	for i, cas := range cases {
-		dbgprintf("ExpectNotifyEvents: i=%d\n", i)
+		debugf("ExpectNotifyEvents: i=%d\n", i)
 		cas.Event.Action()
 		Sync()
 		switch cas.Receiver {
@@ -920,11 +934,11 @@ func (n *N) ExpectNotifyEvents(cases []NCase, all Chans) {
 			case collected := <-ch:
 			Compare:
 				for j, ei := range collected {
-					dbgprintf("received: path=%q, event=%v, sys=%v (i=%d, j=%d)", ei.Path(),
+					debugf("received: path=%q, event=%v, sys=%v (i=%d, j=%d)", ei.Path(),
 						ei.Event(), ei.Sys(), i, j)
 					for _, want := range cas.Event.Events {
 						if err := EqualEventInfo(want, ei); err != nil {
-							dbgprint(err, j)
+							debug(fmt.Sprint(err, j))
 							continue
 						}
 						continue Compare
@@ -4,19 +4,116 @@
 
 package notify
 
+import (
+	"hash/fnv"
+	"sync"
+)
+
 const buffer = 128
 
 type tree interface {
 	Watch(string, chan<- EventInfo, ...Event) error
+	WatchWith(string, chan<- EventInfo, *watchOptions, ...Event) error
+	Unwatch(string, chan<- EventInfo, Event) error
 	Stop(chan<- EventInfo)
+	Dropped(chan<- EventInfo) uint64
+	Stats() Statistics
+	Watches() WatchList
 	Close() error
 }
 
-func newTree() tree {
-	c := make(chan EventInfo, buffer)
-	w := newWatcher(c)
-	if rw, ok := w.(recursiveWatcher); ok {
-		return newRecursiveTree(rw, c)
+func newTree(o *options, errs *errorsChan) (tree, Backend) {
+	c := make(chan EventInfo, o.buffer)
+	w, b := newBackend(o, c)
+	if ew, ok := w.(errorWatcher); ok {
+		ew.SetErrorHandler(errs.report)
+	}
+	if mw, ok := w.(moveWatcher); ok {
+		mw.SetMoveWindow(o.move)
+	}
+	if ow, ok := w.(orderedWatcher); ok && o.order != 0 {
+		ow.SetOrdered()
+	}
+	sw, _ := w.(statWatcher)
+	ew, perdir := w.(excludeWatcher)
+	// Polling directories over the watch limit requires recursive watchpoints
+	// to be emulated by the tree.
+	if rw, ok := w.(recursiveWatcher); ok && !(perdir && o.pollfb) {
+		t := newRecursiveTree(rw, c, o.order)
+		t.errs = errs
+		t.cnt.sw = sw
+		if perdir {
+			t.perdir = true
+			ew.SetExcluded(t.excluded)
+		}
+		if rs, ok := w.(rescanWatcher); ok && o.rescan {
+			rs.SetRescan()
+		}
+		return t, b
+	}
+	t := newNonrecursiveTree(w, c, make(chan EventInfo, o.buffer), o.order)
+	t.rescan = o.rescan
+	t.errs = errs
+	if o.pollfb {
+		t.poll = newPoller(c, o.poll)
+	}
+	t.cnt.sw = sw
+	return t, b
+}
+
+// dispatchWith calls fn for every event received from c, until c is closed and
+// all the calls return. With zero workers every call is made in a separate
+// goroutine. Otherwise calls are made by the given number of workers, events
+// for a single path are always handled by the same worker in order.
+func dispatchWith(c <-chan EventInfo, workers int, fn func(EventInfo)) {
+	var wg sync.WaitGroup
+	if workers == 0 {
+		for ei := range c {
+			wg.Add(1)
+			go func(ei EventInfo) {
+				defer wg.Done()
+				fn(ei)
+			}(ei)
+		}
+		wg.Wait()
+		return
+	}
+	queues := make([]chan EventInfo, workers)
+	wg.Add(workers)
+	for i := range queues {
+		queues[i] = make(chan EventInfo, buffer)
+		go func(q <-chan EventInfo) {
+			defer wg.Done()
+			for ei := range q {
+				fn(ei)
+			}
+		}(queues[i])
+	}
+	for ei := range c {
+		h := fnv.New32a()
+		h.Write([]byte(ei.Path()))
+		queues[h.Sum32()%uint32(workers)] <- ei
+	}
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+}
+
+// dispatchOverflow appends to d an Overflow event for every user channel
+// registered within a subtree rooted at nd.
+func dispatchOverflow(nd node, ei EventInfo, d *deliveries) {
+	nd.Walk(func(nd node) error {
+		nd.Watch.DispatchOverflow(ei, nd.Name, d)
+		return nil
+	})
+}
+
+// moveset replaces Move in the event set e with Create, Remove and Rename events,
+// if the watcher w is not able to report Move events.
+func moveset(w interface{}, e Event) Event {
+	if _, ok := w.(moveWatcher); !ok && e&Move != 0 {
+		e = e&^Move | Create | Remove | Rename
 	}
-	return newNonrecursiveTree(w, c, make(chan EventInfo, buffer))
+	return e
 }
@@ -4,93 +4,198 @@
 
 package notify
 
-import "sync"
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
 
 // nonrecursiveTree TODO(rjeczalik)
 type nonrecursiveTree struct {
+	cnt  counters     // statistics
 	rw   sync.RWMutex // protects root
 	root root
 	w    watcher
 	c    chan EventInfo
 	rec  chan EventInfo
+	// rescan enables rescanning recursive watchpoints on Overflow
+	rescan bool
+	errs   *errorsChan
+	sinks  *sinks
+	// excl holds filters of recursive watchpoints
+	excl exclusions
+	// poll polls directories, which are over the watch limit, nil if disabled
+	poll *poller
+	// rev holds persistent watchpoints of removed paths
+	rev *revival
 }
 
 // newNonrecursiveTree TODO(rjeczalik)
-func newNonrecursiveTree(w watcher, c, rec chan EventInfo) *nonrecursiveTree {
+//
+// Events are dispatched by the given number of workers, zero means unbounded.
+func newNonrecursiveTree(w watcher, c, rec chan EventInfo, workers int) *nonrecursiveTree {
 	if rec == nil {
 		rec = make(chan EventInfo, buffer)
 	}
 	t := &nonrecursiveTree{
-		root: root{nd: newnode("")},
-		w:    w,
-		c:    c,
-		rec:  rec,
+		root:  root{nd: newnode("")},
+		w:     w,
+		c:     c,
+		rec:   rec,
+		sinks: newSinks(),
+		excl:  make(exclusions),
 	}
-	go t.dispatch(c)
+	t.sinks.Internal(t.rec)
+	t.rev = newRevival(t.WatchWith, t.drop, t.sinks)
+	go t.dispatch(c, workers)
 	go t.internal(rec)
 	return t
 }
 
 // dispatch TODO(rjeczalik)
-func (t *nonrecursiveTree) dispatch(c <-chan EventInfo) {
-	for ei := range c {
-		dbgprintf("dispatching %v on %q", ei.Event(), ei.Path())
-		go func(ei EventInfo) {
-			var nd node
-			var isrec bool
-			dir, base := split(ei.Path())
-			fn := func(it node, isbase bool) error {
-				isrec = isrec || it.Watch.IsRecursive()
-				if isbase {
-					nd = it
-				} else {
-					it.Watch.Dispatch(ei, recursive)
-				}
-				return nil
-			}
-			t.rw.RLock()
-			// Notify recursive watchpoints found on the path.
-			if err := t.root.WalkPath(dir, fn); err != nil {
-				dbgprint("dispatch did not reach leaf:", err)
-				t.rw.RUnlock()
-				return
-			}
-			// Notify parent watchpoint.
-			nd.Watch.Dispatch(ei, 0)
-			isrec = isrec || nd.Watch.IsRecursive()
-			// If leaf watchpoint exists, notify it.
-			if nd, ok := nd.Child[base]; ok {
-				isrec = isrec || nd.Watch.IsRecursive()
-				nd.Watch.Dispatch(ei, 0)
-			}
-			t.rw.RUnlock()
-			// If the event describes newly leaf directory created within
-			if !isrec || ei.Event()&(Create|Remove) == 0 {
-				return
-			}
-			if ok, err := ei.(isDirer).isDir(); !ok || err != nil {
-				return
-			}
+//
+// When c gets closed, dispatch waits for all pending events to be dispatched
+// and closes rec channel, which terminates the internal goroutine.
+func (t *nonrecursiveTree) dispatch(c <-chan EventInfo, workers int) {
+	dispatchWith(c, workers, func(ei EventInfo) {
+		debug("dispatching", "event", ei.Event(), "path", ei.Path())
+		defer t.cnt.dispatched(ei, time.Now())
+		switch ei.Event() {
+		case Overflow:
+			t.overflow(ei)
+			return
+		case Invalidated:
+			t.invalidate(ei.Path())
+			return
+		}
+		var d deliveries
+		t.rw.RLock()
+		isrec := t.dispatchEvent(ei, &d)
+		ignore := isrec && isIgnoreFile(ei.Path()) && t.excl.ignoring(ei.Path())
+		t.rw.RUnlock()
+		d.Send(t.sinks)
+		if ignore {
+			// Ignore file has changed, reevaluate its directory.
 			t.rec <- ei
-		}(ei)
+			return
+		}
+		// If the event describes newly leaf directory created within
+		if !isrec || ei.Event()&(Create|Remove) == 0 {
+			return
+		}
+		if _, ok := ei.(*moved); ok {
+			// Internal watchpoints receive original Create events.
+			return
+		}
+		if ok, err := ei.(isDirer).isDir(); !ok || err != nil {
+			return
+		}
+		t.rec <- ei
+	})
+	close(t.rec)
+}
+
+// dispatchEvent notifies all watchpoints the ei is relevant to and reports
+// whether any of them was recursive. It expects t.rw to be locked.
+func (t *nonrecursiveTree) dispatchEvent(ei EventInfo, d *deliveries) (isrec bool) {
+	isrec = t.dispatchPath(ei.Path(), ei, d)
+	if mi, ok := ei.(*moved); ok && mi.old != "" {
+		// Notify also the watchpoints the file was moved from, each channel
+		// receives the Move event at most once.
+		n := len(*d)
+		seen := make(map[chan<- EventInfo]struct{}, n)
+		for _, d := range *d {
+			seen[d.c] = struct{}{}
+		}
+		t.dispatchPath(mi.old, ei, d)
+		for _, dv := range (*d)[n:] {
+			if _, ok := seen[dv.c]; !ok {
+				seen[dv.c] = struct{}{}
+				(*d)[n] = dv
+				n++
+			}
+		}
+		*d = (*d)[:n]
+	}
+	return isrec
+}
+
+// dispatchPath notifies all watchpoints the path is relevant to about ei and
+// reports whether any of them was recursive. It expects t.rw to be locked.
+func (t *nonrecursiveTree) dispatchPath(path string, ei EventInfo, d *deliveries) (isrec bool) {
+	var nd node
+	dir, base := split(path)
+	fn := func(it node, isbase bool) error {
+		isrec = isrec || it.Watch.IsRecursive()
+		if isbase {
+			nd = it
+		} else {
+			it.Watch.Dispatch(ei, recursive, d)
+		}
+		return nil
+	}
+	// Notify recursive watchpoints found on the path.
+	if err := t.root.WalkPath(dir, fn); err != nil {
+		debug("dispatch did not reach leaf", "path", path, "err", err)
+		return false
+	}
+	// Notify parent watchpoint.
+	nd.Watch.Dispatch(ei, 0, d)
+	isrec = isrec || nd.Watch.IsRecursive()
+	// If leaf watchpoint exists, notify it.
+	if nd, ok := nd.Child[base]; ok {
+		isrec = isrec || nd.Watch.IsRecursive()
+		nd.Watch.Dispatch(ei, 0, d)
+	}
+	return isrec
+}
+
+// overflow notifies all user channels about lost events and, if enabled,
+// requests a rescan of recursive watchpoints.
+func (t *nonrecursiveTree) overflow(ei EventInfo) {
+	var d deliveries
+	t.rw.RLock()
+	dispatchOverflow(t.root.nd, ei, &d)
+	t.rw.RUnlock()
+	d.Send(t.sinks)
+	if t.rescan {
+		t.rec <- ei
+	}
+}
+
+// invalidate removes the watchpoints of the path, which is gone. Internal
+// watchpoints of directories within recursive watchpoints are removed along
+// with their subtrees.
+func (t *nonrecursiveTree) invalidate(path string) {
+	t.rev.invalidate(path)
+	t.rw.Lock()
+	if nd, err := t.root.Get(path); err == nil && t.internalonly(nd) {
+		t.remove(path)
 	}
+	t.rw.Unlock()
 }
 
 // internal TODO(rjeczalik)
 func (t *nonrecursiveTree) internal(rec <-chan EventInfo) {
 	for ei := range rec {
 		t.rw.Lock()
+		switch ei.Event() {
+		case Overflow:
+			d := t.rescanrec()
+			t.rw.Unlock()
+			d.Send(t.sinks)
+			continue
+		}
+		if isIgnoreFile(ei.Path()) && t.excl.ignoring(ei.Path()) {
+			t.reignore(ei.Path())
+			t.rw.Unlock()
+			continue
+		}
 		if ei.Event() == Remove {
-			nd, err := t.root.Get(ei.Path())
-			if err != nil {
-				t.rw.Unlock()
-				continue
-			}
-			t.walkWatchpoint(nd, func(_ Event, nd node) error {
-				t.w.Unwatch(nd.Name)
-				return nil
-			})
-			t.root.Del(ei.Path())
+			t.remove(ei.Path())
 			t.rw.Unlock()
 			continue
 		}
@@ -110,12 +215,140 @@ func (t *nonrecursiveTree) internal(rec <-chan EventInfo) {
 		if ei.Path() != nd.Name {
 			nd = nd.Add(ei.Path())
 		}
-		err := nd.AddDir(t.recFunc(eset))
+		err := t.addrec(nd, nd.AddDir, eset, false)
 		t.rw.Unlock()
 		if err != nil {
-			dbgprintf("internal(%p) error: %v", rec, err)
+			t.errs.report(&WatchError{Op: "watch", Path: ei.Path(), Err: err})
+		}
+	}
+}
+
+// reignore reevaluates the directory of the given ignore file after it has
+// changed - directories which got ignored are unwatched, while directories
+// which are no longer ignored get watched. It expects t.rw to be locked.
+func (t *nonrecursiveTree) reignore(path string) {
+	dir, _ := split(path)
+	for _, fs := range t.excl {
+		for _, f := range fs {
+			if f != nil && f.ign != nil {
+				f.ign.invalidate(dir)
+			}
+		}
+	}
+	nd, err := t.root.Get(dir)
+	if err != nil {
+		return
+	}
+	eset := nd.Watch[t.rec]
+	if eset == 0 {
+		return
+	}
+	var ignored []string
+	nd.Walk(func(it node) error {
+		if it.Name != nd.Name && t.excl.excluded(it.Name) {
+			if t.internalonly(it) {
+				ignored = append(ignored, it.Name)
+			}
+			return errSkip
+		}
+		return nil
+	})
+	for _, name := range ignored {
+		t.remove(name)
+	}
+	if err := t.addrec(nd, nd.AddDir, eset, false); err != nil {
+		t.errs.report(&WatchError{Op: "watch", Path: dir, Err: err})
+	}
+}
+
+// internalonly reports whether the subtree rooted at nd has no user watchpoints.
+// It expects t.rw to be locked.
+func (t *nonrecursiveTree) internalonly(nd node) bool {
+	return nd.Walk(func(it node) error {
+		for c := range it.Watch {
+			if c != nil && c != t.rec {
+				return errUser
+			}
+		}
+		return nil
+	}) == nil
+}
+
+var errUser = errors.New("notify: user watchpoint found")
+
+// remove unwatches every directory within a subtree rooted at the given path
+// and removes the subtree from the tree. It expects t.rw to be locked.
+func (t *nonrecursiveTree) remove(path string) {
+	nd, err := t.root.Get(path)
+	if err != nil {
+		return
+	}
+	t.walkWatchpoint(nd, func(_ Event, nd node) error {
+		err := t.watcher(nd.Name).Unwatch(nd.Name)
+		if err != nil && !errors.Is(err, ErrNotWatched) {
+			t.errs.report(&WatchError{Op: "unwatch", Path: nd.Name, Err: err})
+		}
+		return nil
+	})
+	t.root.Del(path)
+}
+
+// rescanrec reads again every directory covered by recursive watchpoints and
+// reconciles the tree with the filesystem - directories that no longer exist
+// are removed from the tree and reported with Remove event, new directories
+// are watched and reported, with their content, with Create events. It
+// expects t.rw to be locked.
+func (t *nonrecursiveTree) rescanrec() (d deliveries) {
+	type newdir struct {
+		parent node
+		base   string
+		eset   Event
+	}
+	var gone []string
+	var added []newdir
+	t.root.nd.Walk(func(nd node) error {
+		eset := nd.Watch[t.rec]
+		if eset == 0 {
+			return nil
+		}
+		fi, err := os.ReadDir(nd.Name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				gone = append(gone, nd.Name)
+				return errSkip
+			}
+			t.errs.report(&WatchError{Op: "rescan", Path: nd.Name, Err: err})
+			return nil
+		}
+		for _, fi := range fi {
+			if fi.Type()&(fs.ModeSymlink|fs.ModeDir) != fs.ModeDir {
+				continue
+			}
+			if child, ok := nd.Child[fi.Name()]; ok && child.Watch[t.rec] != 0 {
+				continue
+			}
+			added = append(added, newdir{parent: nd, base: fi.Name(), eset: eset})
 		}
+		return nil
+	})
+	for _, name := range gone {
+		t.dispatchEvent(&synthetic{e: Remove, p: name, d: true}, &d)
+		t.remove(name)
+	}
+	for _, dir := range added {
+		name := filepath.Join(dir.parent.Name, dir.base)
+		nd := dir.parent.addchild(name, dir.base)
+		if err := t.addrec(nd, nd.AddDir, dir.eset, false); err != nil {
+			t.errs.report(&WatchError{Op: "rescan", Path: name, Err: err})
+		}
+		filepath.WalkDir(name, func(path string, de fs.DirEntry, err error) error {
+			if err == nil {
+				t.dispatchEvent(&synthetic{e: Create, p: path, d: de.IsDir()}, &d)
+			}
+			return nil
+		})
 	}
+	return d
 }
 
 // watchAdd TODO(rjeczalik)
@@ -163,6 +396,13 @@ func (t *nonrecursiveTree) watchDel(nd node, c chan<- EventInfo, e Event) eventD
 
 // Watch TODO(rjeczalik)
 func (t *nonrecursiveTree) Watch(path string, c chan<- EventInfo, events ...Event) error {
+	return t.WatchWith(path, c, nil, events...)
+}
+
+// WatchWith works like Watch, additionally configuring c with the given
+// options. Nil o means no options.
+func (t *nonrecursiveTree) WatchWith(path string, c chan<- EventInfo, o *watchOptions,
+	events ...Event) (err error) {
 	if c == nil {
 		panic("notify: Watch using nil channel")
 	}
@@ -170,18 +410,57 @@ func (t *nonrecursiveTree) Watch(path string, c chan<- EventInfo, events ...Even
 	if len(events) == 0 {
 		return nil
 	}
-	path, isrec, err := cleanpath(path)
+	realpath, isrec, named, err := cleanpathname(path, o != nil && o.byname)
+	if err != nil {
+		if o != nil && o.missing && os.IsNotExist(err) {
+			if e := joinevents(events) &^ (Overflow | Invalidated); e != 0 {
+				return t.rev.await(path, c, o, e)
+			}
+			return nil
+		}
+		return err
+	}
+	path = realpath
+	eset := joinevents(events) &^ (Overflow | Invalidated)
+	if eset == 0 {
+		// Overflow and Invalidated are always delivered, expanding with them
+		// alone is a nop.
+		return nil
+	}
+	eset = moveset(t.w, eset)
+	f, err := newFilter(o, path)
+	if err != nil {
+		return err
+	}
+	created, err := t.sinks.Add(c, o)
 	if err != nil {
 		return err
 	}
-	eset := joinevents(events)
+	defer func() {
+		if err != nil && created {
+			t.sinks.Del(c)
+		}
+	}()
+	sc := scope{path: path, isrec: isrec, events: eset, f: f, o: o, name: named}
 	t.rw.Lock()
 	defer t.rw.Unlock()
-	nd := t.root.Add(path)
+	nd := t.root.Add(sc.watched())
 	if isrec {
-		return t.watchrec(nd, c, eset|recursive)
+		var ie Event
+		if f != nil && f.ign != nil {
+			// Listen on changes to ignore files.
+			ie = Create | Remove | Write | Rename
+		}
+		restore := t.excl.set(path, c, f)
+		if err = t.watchrec(nd, c, eset|recursive, ie, o != nil && o.rollback); err != nil {
+			restore()
+			return err
+		}
+	} else if err = t.watch(nd, c, eset); err != nil {
+		return err
 	}
-	return t.watch(nd, c, eset)
+	t.sinks.Scope(c, sc)
+	return nil
 }
 
 func (t *nonrecursiveTree) watch(nd node, c chan<- EventInfo, e Event) (err error) {
@@ -195,7 +474,7 @@ func (t *nonrecursiveTree) watch(nd node, c chan<- EventInfo, e Event) (err erro
 	case diff[0] == 0:
 		err = t.w.Watch(nd.Name, diff[1])
 	default:
-		err = t.w.Rewatch(nd.Name, diff[0], diff[1])
+		err = t.watcher(nd.Name).Rewatch(nd.Name, diff[0], diff[1])
 	}
 	if err != nil {
 		nd.Watch.Del(c, diff.Event())
@@ -204,31 +483,59 @@ func (t *nonrecursiveTree) watch(nd node, c chan<- EventInfo, e Event) (err erro
 	return nil
 }
 
-func (t *nonrecursiveTree) recFunc(e Event) walkFunc {
-	return func(nd node) error {
+// recFunc gives a function, which sets up an internal watchpoint with the
+// event set e on a node of the traversal rw.
+func (t *nonrecursiveTree) recFunc(e Event, rw *recwatch) walkFunc {
+	return func(nd node) (err error) {
+		if t.excl.excluded(nd.Name) {
+			return errSkip
+		}
+		prev := nd.Watch[t.rec]
 		switch diff := nd.Watch.Add(t.rec, e|omit|Create); {
 		case diff == none:
 		case diff[1] == 0:
 			// TODO(rjeczalik): cleanup this panic after implementation is stable
 			panic("eset is empty: " + nd.Name)
 		case diff[0] == 0:
-			t.w.Watch(nd.Name, diff[1])
+			if err = t.watchdir(nd.Name, diff[1], rw); err != nil {
+				nd.Watch.Del(t.rec, nd.Watch[t.rec]&^prev)
+				rw.err = err
+				return err
+			}
 		default:
-			t.w.Rewatch(nd.Name, diff[0], diff[1])
+			if err = t.watcher(nd.Name).Rewatch(nd.Name, diff[0], diff[1]); err != nil {
+				err = &WatchError{Op: "rewatch", Path: nd.Name, Err: err}
+				if rw.rollback {
+					nd.Watch.Del(t.rec, nd.Watch[t.rec]&^prev)
+					rw.err = err
+					return err
+				}
+				t.errs.report(err)
+			}
 		}
+		rw.undo = append(rw.undo, recundo{nd: nd, prev: prev})
 		return nil
 	}
 }
 
-func (t *nonrecursiveTree) watchrec(nd node, c chan<- EventInfo, e Event) error {
+// watchrec sets a recursive watchpoint for c on nd. The ie are extra events
+// the internal watchpoints of the subtree listen on. If rollback is true, the
+// watchpoint is set either for the whole subtree or not at all.
+func (t *nonrecursiveTree) watchrec(nd node, c chan<- EventInfo, e, ie Event, rollback bool) error {
 	var traverse func(walkFunc) error
 	// Non-recursive tree listens on Create event for every recursive
 	// watchpoint in order to automagically set a watch for every
 	// created directory.
-	switch diff := nd.Watch.dryAdd(t.rec, e|Create); {
+	rece := e | ie
+	switch diff := nd.Watch.dryAdd(t.rec, rece|Create); {
+	case diff == none && t.excl.excluding(nd.Name, c):
+		// Directories excluded by other watchpoints may be required by this
+		// one, look for them.
+		rece |= nd.Watch[t.rec] &^ internal
+		traverse = nd.AddDir
 	case diff == none:
 		t.watchAdd(nd, c, e)
-		nd.Watch.Add(t.rec, e|omit|Create)
+		nd.Watch.Add(t.rec, rece|omit|Create)
 		return nil
 	case diff[1] == 0:
 		// TODO(rjeczalik): cleanup this panic after implementation is stable
@@ -242,8 +549,13 @@ func (t *nonrecursiveTree) watchrec(nd node, c chan<- EventInfo, e Event) error
 	}
 	// TODO(rjeczalik): account every path that failed to be (re)watched
 	// and retry.
-	if err := traverse(t.recFunc(e)); err != nil {
-		return err
+	if err := t.addrec(nd, traverse, rece, rollback); err != nil {
+		var lerr *WatchLimitError
+		if rollback || !errors.As(err, &lerr) {
+			return err
+		}
+		// The watch stays in place, covering directories watched so far.
+		t.errs.report(&WatchError{Op: "watch", Path: nd.Name, Err: err})
 	}
 	t.watchAdd(nd, c, e)
 	return nil
@@ -280,30 +592,138 @@ Traverse:
 	return nil
 }
 
+// unwatch removes the events e for c from the watchpoint on nd, updating the
+// watcher accordingly. It expects t.rw to be locked.
+func (t *nonrecursiveTree) unwatch(min Event, nd node, c chan<- EventInfo, e Event) {
+	// TODO(rjeczalik): aggregate watcher errors and retry.
+	switch diff := t.watchDelMin(min, nd, c, e); {
+	case diff == none:
+	case diff[1] == 0:
+		err := t.watcher(nd.Name).Unwatch(nd.Name)
+		if err != nil && !errors.Is(err, ErrNotWatched) {
+			// Watches of removed paths may be gone already.
+			t.errs.report(&WatchError{Op: "unwatch", Path: nd.Name, Err: err})
+		}
+	default:
+		if err := t.watcher(nd.Name).Rewatch(nd.Name, diff[0], diff[1]); err != nil {
+			t.errs.report(&WatchError{Op: "rewatch", Path: nd.Name, Err: err})
+		}
+	}
+}
+
+// Unwatch removes the events for c from the watchpoint on the given path. The
+// watchpoint is removed once it has no events left, other watchpoints of c
+// are left intact.
+func (t *nonrecursiveTree) Unwatch(path string, c chan<- EventInfo, events Event) error {
+	// Watchpoints of removed paths can be unwatched as well.
+	path, isrec, err := cleanpathgone(path)
+	if err != nil {
+		return err
+	}
+	events = moveset(t.w, events&^(Overflow|Invalidated))
+	if t.rev.unwatch(path, isrec, c, events) {
+		return nil
+	}
+	if _, ok := t.sinks.Scopes(c).get(path, isrec); !ok {
+		return &WatchError{Op: "unwatch", Path: path, Err: ErrNotWatched}
+	}
+	if !t.unscope(path, isrec, c, events) {
+		t.sinks.Del(c)
+	}
+	return nil
+}
+
+// drop removes the watchpoint of the given kind on the path for c, whose path
+// is gone. Unlike Unwatch, it keeps c registered.
+func (t *nonrecursiveTree) drop(path string, isrec bool, c chan<- EventInfo) error {
+	if _, ok := t.sinks.Scopes(c).get(path, isrec); !ok {
+		return ErrNotWatched
+	}
+	t.unscope(path, isrec, c, all)
+	return nil
+}
+
+// unscope removes the events for c from the watchpoint of the given kind on
+// the path and reports whether c has any watchpoints left.
+func (t *nonrecursiveTree) unscope(path string, isrec bool, c chan<- EventInfo, events Event) bool {
+	// A file watched by its name is watched by its parent directory.
+	dir := path
+	if s, ok := t.sinks.Scopes(c).get(path, isrec); ok {
+		dir = s.watched()
+	}
+	left := t.sinks.Unscope(c, path, isrec, events)
+	// Watchpoints of both recursive and non-recursive watches on the same path
+	// are merged, compute what the remaining ones still require.
+	var want Event
+	for _, s := range t.sinks.Scopes(c) {
+		if s.watched() == dir {
+			want |= s.events
+			if s.isrec {
+				want |= recursive
+			}
+		}
+	}
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	if isrec && want&recursive == 0 {
+		t.excl.del(path, c)
+	}
+	fn := func(min Event, nd node) error {
+		switch {
+		case nd.Name == dir:
+			t.unwatch(min, nd, c, nd.Watch[c]&^want)
+		case indexrel(dir, nd.Name) != -1:
+			// Internal watchpoints of the subtree may need less events now.
+			t.unwatch(min, nd, c, 0)
+		case indexrel(nd.Name, dir) == -1 && nd.Name != "":
+			return errSkip
+		}
+		return nil
+	}
+	err := t.walkWatchpoint(t.root.nd, fn)
+	debug("unwatched", "path", path, "event", events, chanattr(c), "err", err)
+	return left
+}
+
 // Stop TODO(rjeczalik)
 func (t *nonrecursiveTree) Stop(c chan<- EventInfo) {
 	fn := func(min Event, nd node) error {
-		// TODO(rjeczalik): aggregate watcher errors and retry; in worst case
-		// forward to the user.
-		switch diff := t.watchDelMin(min, nd, c, all); {
-		case diff == none:
-			return nil
-		case diff[1] == 0:
-			t.w.Unwatch(nd.Name)
-		default:
-			t.w.Rewatch(nd.Name, diff[0], diff[1])
-		}
+		t.unwatch(min, nd, c, all)
 		return nil
 	}
+	t.rev.stopc(c)
+	t.sinks.Del(c)
 	t.rw.Lock()
+	t.excl.stop(c)
 	err := t.walkWatchpoint(t.root.nd, fn) // TODO(rjeczalik): store max root per c
 	t.rw.Unlock()
-	dbgprintf("Stop(%p) error: %v\n", c, err)
+	debug("stopped", chanattr(c), "err", err)
 }
 
 // Close TODO(rjeczalik)
 func (t *nonrecursiveTree) Close() error {
+	t.rev.close()
 	err := t.w.Close()
+	if t.poll != nil {
+		t.poll.Close()
+	}
 	close(t.c)
+	t.sinks.Close()
 	return err
 }
+
+// Stats gives a snapshot of the tree statistics.
+func (t *nonrecursiveTree) Stats() Statistics {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	st := t.cnt.stats(countnodes(t.root.nd), t.sinks)
+	if t.poll != nil {
+		st.Read += t.poll.Read()
+	}
+	return st
+}
+
+// Dropped gives the number of events dropped for c.
+func (t *nonrecursiveTree) Dropped(c chan<- EventInfo) uint64 {
+	return t.sinks.Dropped(c)
+}
@@ -5,8 +5,14 @@
 package notify
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNonrecursiveTree(t *testing.T) {
@@ -539,3 +545,315 @@ func TestNonrecursiveTreeInternal(t *testing.T) {
 
 	n.ExpectTreeEvents(events[:], ch)
 }
+
+func TestNonrecursiveTreeOverflow(t *testing.T) {
+	n := NewNonrecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(3)
+
+	n.Watch("src/github.com/rjeczalik/fs/cmd/...", ch[0], Remove)
+	n.Watch("src/github.com/pblaszczyk/qttu/include", ch[1], Create)
+
+	n.c <- &Call{E: Overflow}
+
+	for i, want := range []string{"src/github.com/rjeczalik/fs/cmd", "src/github.com/pblaszczyk/qttu/include"} {
+		want = filepath.Join(n.realroot, filepath.FromSlash(want))
+		select {
+		case ei := <-ch[i]:
+			if ei.Event() != Overflow || ei.Path() != want {
+				t.Fatalf("want Overflow on %s; got %v on %s (i=%d)", want, ei.Event(), ei.Path(), i)
+			}
+		case <-time.After(n.timeout()):
+			t.Fatalf("timed out waiting for Overflow (i=%d)", i)
+		}
+	}
+
+	n.expectDry(ch, -1)
+}
+
+func TestNonrecursiveTreeRescan(t *testing.T) {
+	n := NewNonrecursiveTreeTest(t, "testdata/vfs.txt")
+	n.tree.(*nonrecursiveTree).rescan = true
+
+	ch := NewChans(1)
+
+	n.Watch("src/github.com/rjeczalik/fs/cmd/...", ch[0], Create|Remove)
+
+	cmd := filepath.Join(n.realroot, filepath.FromSlash("src/github.com/rjeczalik/fs/cmd"))
+	mustT(t, os.RemoveAll(filepath.Join(cmd, "mktree")))
+	mustT(t, os.MkdirAll(filepath.Join(cmd, "newtree", "sub"), 0755))
+	mustT(t, os.WriteFile(filepath.Join(cmd, "newtree", "main.go"), nil, 0644))
+
+	n.c <- &Call{E: Overflow}
+
+	want := map[string]Event{
+		cmd:                                      Overflow,
+		filepath.Join(cmd, "mktree"):             Remove,
+		filepath.Join(cmd, "newtree"):            Create,
+		filepath.Join(cmd, "newtree", "sub"):     Create,
+		filepath.Join(cmd, "newtree", "main.go"): Create,
+	}
+	for len(want) != 0 {
+		select {
+		case ei := <-ch[0]:
+			if e, ok := want[ei.Path()]; !ok || e != ei.Event() {
+				t.Fatalf("unexpected event %v on %s", ei.Event(), ei.Path())
+			}
+			delete(want, ei.Path())
+		case <-time.After(n.timeout()):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+
+	n.expectDry(ch, -1)
+
+	record := map[string]FuncType{
+		filepath.Join(cmd, "mktree"):         FuncUnwatch,
+		filepath.Join(cmd, "newtree"):        FuncWatch,
+		filepath.Join(cmd, "newtree", "sub"): FuncWatch,
+	}
+	for _, call := range (*n.spy)[n.j:] {
+		if f, ok := record[call.P]; ok && f == call.F {
+			delete(record, call.P)
+		}
+	}
+	if len(record) != 0 {
+		t.Fatalf("want calls to be recorded: %v", record)
+	}
+}
+
+type failWatcher struct {
+	*Spy
+	fail string
+}
+
+var errFail = errors.New("watch failed")
+
+func (w failWatcher) Watch(p string, e Event) error {
+	if filepath.Base(p) == w.fail {
+		return errFail
+	}
+	return w.Spy.Watch(p, e)
+}
+
+func TestNonrecursiveTreeErrors(t *testing.T) {
+	n := newTreeN(t, "testdata/vfs.txt")
+	tr := newNonrecursiveTree(failWatcher{Spy: n.spy, fail: "denied"}, n.c, nil, 0)
+	tr.errs = newErrorsChan(buffer)
+	n.tree = tr
+	t.Cleanup(n.Close)
+
+	ch := NewChans(1)
+
+	n.Watch("src/github.com/rjeczalik/fs/cmd/...", ch[0], Create)
+
+	dir := filepath.Join(n.realroot, filepath.FromSlash("src/github.com/rjeczalik/fs/cmd/denied"))
+	mustT(t, os.Mkdir(dir, 0755))
+
+	n.c <- &Call{P: dir, E: Create, Dir: true}
+
+	select {
+	case err := <-tr.errs.c:
+		var werr *WatchError
+		if !errors.As(err, &werr) {
+			t.Fatalf("want err to be *WatchError; got %T", err)
+		}
+		if werr.Op != "watch" || werr.Path != dir || werr.Err != errFail {
+			t.Fatalf("want Op=watch, Path=%s, Err=%v; got %+v", dir, errFail, werr)
+		}
+	case <-time.After(n.timeout()):
+		t.Fatal("timed out waiting for an error")
+	}
+}
+
+// limitWatcher fails with *WatchLimitError once it holds max watches.
+type limitWatcher struct {
+	*Spy
+	max int
+}
+
+func (w limitWatcher) Watch(p string, e Event) error {
+	held := 0
+	for _, call := range *w.Spy {
+		switch call.F {
+		case FuncWatch:
+			held++
+		case FuncUnwatch:
+			held--
+		}
+	}
+	if held >= w.max {
+		return &WatchLimitError{Max: w.max, Held: held, Needed: 1, Err: errFail}
+	}
+	return w.Spy.Watch(p, e)
+}
+
+func newLimitTreeN(t *testing.T, max int) (*N, *nonrecursiveTree) {
+	n := newTreeN(t, "testdata/vfs.txt")
+	tr := newNonrecursiveTree(limitWatcher{Spy: n.spy, max: max}, n.c, nil, 0)
+	tr.errs = newErrorsChan(buffer)
+	n.tree = tr
+	t.Cleanup(n.Close)
+	return n, tr
+}
+
+func TestNonrecursiveTreeWatchLimit(t *testing.T) {
+	path := "src/github.com/rjeczalik/fs/cmd/..."
+	check := func(t *testing.T, err error) {
+		t.Helper()
+		var lerr *WatchLimitError
+		if !errors.Is(err, ErrWatchLimit) || !errors.As(err, &lerr) {
+			t.Fatalf("want err=%v; got %v", ErrWatchLimit, err)
+		}
+		// The cmd, cmd/gotree and cmd/mktree directories.
+		if lerr.Needed != 3 {
+			t.Fatalf("want Needed=3; got %d", lerr.Needed)
+		}
+	}
+	t.Run("Default", func(t *testing.T) {
+		n, tr := newLimitTreeN(t, 2)
+		ch := NewChans(1)
+		mustT(t, tr.WatchWith(filepath.Join(n.w.root, path), ch[0], nil, Create))
+		select {
+		case err := <-tr.errs.c:
+			check(t, err)
+		case <-time.After(n.timeout()):
+			t.Fatal("timed out waiting for an error")
+		}
+		if wl := tr.Watches(); len(wl) != 1 {
+			t.Fatalf("want the watch to stay in place; got %v", wl)
+		}
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		n, tr := newLimitTreeN(t, 2)
+		ch := NewChans(1)
+		o := newWatchOptions([]WatchOption{Rollback()})
+		check(t, tr.WatchWith(filepath.Join(n.w.root, path), ch[0], o, Create))
+		watched := make(map[string]int)
+		for _, call := range *n.spy {
+			switch call.F {
+			case FuncWatch:
+				watched[call.P]++
+			case FuncUnwatch:
+				watched[call.P]--
+			}
+		}
+		for p, k := range watched {
+			if k != 0 {
+				t.Fatalf("want %s to be unwatched", p)
+			}
+		}
+		if len(watched) != 2 {
+			t.Fatalf("want 2 directories to be rolled back; got %v", watched)
+		}
+		if wl := tr.Watches(); len(wl) != 0 {
+			t.Fatalf("want no watches; got %v", wl)
+		}
+		nd, err := tr.root.Get(filepath.Join(n.realroot, filepath.FromSlash("src/github.com/rjeczalik/fs/cmd")))
+		mustT(t, err)
+		if len(nd.Child) != 0 || len(nd.Watch) != 0 {
+			t.Fatalf("want the subtree to be removed; got %+v", nd)
+		}
+	})
+	t.Run("PollFallback", func(t *testing.T) {
+		n, tr := newLimitTreeN(t, 1)
+		tr.poll = newPoller(n.c, 10*time.Millisecond)
+		ch := NewChans(1)
+		mustT(t, tr.WatchWith(filepath.Join(n.w.root, path), ch[0], nil, Create))
+		file := filepath.Join(n.realroot, filepath.FromSlash("src/github.com/rjeczalik/fs/cmd/gotree/file"))
+		mustT(t, os.WriteFile(file, nil, 0644))
+		select {
+		case ei := <-ch[0]:
+			if ei.Event() != Create || ei.Path() != file {
+				t.Fatalf("want Create on %s; got %v", file, ei)
+			}
+		case <-time.After(n.timeout()):
+			t.Fatal("timed out waiting for a polled event")
+		}
+		select {
+		case err := <-tr.errs.c:
+			t.Fatalf("unexpected error: %v", err)
+		default:
+		}
+	})
+}
+
+func TestNonrecursiveTreeMoveDegraded(t *testing.T) {
+	n := NewNonrecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(1)
+
+	n.Watch("src/github.com/rjeczalik/fs", ch[0], Move)
+
+	want := Create | Remove | Rename
+	if calls := *n.spy; len(calls) != 1 || calls[0].E != want {
+		t.Fatalf("want single Watch call with %v; got %+v", want, calls)
+	}
+}
+
+func TestNonrecursiveTreeExclude(t *testing.T) {
+	n := NewNonrecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(2)
+	path := filepath.Join(n.w.root, "src/github.com/rjeczalik/fs/...")
+	o := newWatchOptions([]WatchOption{Exclude("memfs", "cmd/**")})
+
+	watched := func() map[string]bool {
+		m := make(map[string]bool)
+		for _, call := range *n.spy {
+			if call.F == FuncWatch {
+				m[filepath.ToSlash(call.P[len(n.realroot)+1:])] = true
+			}
+		}
+		return m
+	}
+
+	mustT(t, n.tree.WatchWith(path, ch[0], o, Create))
+	for p := range watched() {
+		if strings.Contains(p, "/memfs") || strings.Contains(p, "/cmd") {
+			t.Fatalf("want %s not to be watched", p)
+		}
+	}
+	if m := watched(); !m["src/github.com/rjeczalik/fs/fsutil"] {
+		t.Fatalf("want fsutil to be watched; got %v", m)
+	}
+
+	mustT(t, n.tree.WatchWith(path, ch[1], nil, Create))
+	if m := watched(); !m["src/github.com/rjeczalik/fs/memfs"] || !m["src/github.com/rjeczalik/fs/cmd/gotree"] {
+		t.Fatalf("want excluded directories to be watched; got %v", m)
+	}
+}
+
+func TestNonrecursiveTreeUnwatch(t *testing.T) {
+	n := NewNonrecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(2)
+	path := filepath.Join(n.w.root, "src/github.com/rjeczalik/fs")
+
+	n.Watch("src/github.com/rjeczalik/fs", ch[0], Create|Write)
+	n.Watch("src/github.com/rjeczalik/fs", ch[1], Create)
+
+	cases := []struct {
+		c    chan EventInfo
+		e    []Event
+		want []Call
+	}{
+		{ch[0], []Event{Write}, []Call{{F: FuncRewatch, P: path, E: Create | Write, NE: Create}}},
+		{ch[0], []Event{Create}, nil},
+		{ch[1], nil, []Call{{F: FuncUnwatch, P: path}}},
+	}
+	for i, cas := range cases {
+		*n.spy = nil
+		e := all
+		if len(cas.e) != 0 {
+			e = joinevents(cas.e)
+		}
+		mustT(t, n.tree.Unwatch(path, cas.c, e))
+		if calls := *n.spy; !reflect.DeepEqual(Spy(cas.want), calls) {
+			t.Fatalf("want calls=%+v; got %+v (i=%d)", cas.want, calls, i)
+		}
+	}
+	if err := n.tree.Unwatch(path, ch[0], all); err == nil {
+		t.Fatal("want Unwatch to fail for stopped channel")
+	}
+}
@@ -4,7 +4,12 @@
 
 package notify
 
-import "sync"
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
 
 // watchAdd TODO(rjeczalik)
 func watchAdd(nd node, c chan<- EventInfo, e Event) eventDiff {
@@ -96,6 +101,7 @@ func watchIsRecursive(nd node) bool {
 
 // recursiveTree TODO(rjeczalik)
 type recursiveTree struct {
+	cnt  counters     // statistics
 	rw   sync.RWMutex // protects root
 	root root
 	// TODO(rjeczalik): merge watcher + recursiveWatcher after #5 and #6
@@ -103,57 +109,107 @@ type recursiveTree struct {
 		watcher
 		recursiveWatcher
 	}
-	c chan EventInfo
+	c     chan EventInfo
+	errs  *errorsChan
+	sinks *sinks
+	exmu  sync.RWMutex // protects excl, which is read by the watcher
+	excl  exclusions   // filters of recursive watchpoints
+	// ign is an internal channel of watchpoints listening on changes to
+	// ignore files, it never receives any event
+	ign chan EventInfo
+	rev *revival // persistent watchpoints of removed paths
+	// perdir is true for watchers, which watch every directory separately.
+	// Non-recursive watchpoints are never merged into recursive watches then.
+	perdir bool
 }
 
 // newRecursiveTree TODO(rjeczalik)
-func newRecursiveTree(w recursiveWatcher, c chan EventInfo) *recursiveTree {
+//
+// Events are dispatched by the given number of workers, zero means unbounded.
+func newRecursiveTree(w recursiveWatcher, c chan EventInfo, workers int) *recursiveTree {
 	t := &recursiveTree{
 		root: root{nd: newnode("")},
-		w: struct {
+		// Keep the dynamic type of w, so optional interfaces remain visible.
+		w: w.(interface {
 			watcher
 			recursiveWatcher
-		}{w.(watcher), w},
-		c: c,
+		}),
+		c:     c,
+		sinks: newSinks(),
+		excl:  make(exclusions),
+		ign:   make(chan EventInfo),
 	}
-	go t.dispatch()
+	t.sinks.Internal(t.ign)
+	t.rev = newRevival(t.WatchWith, t.drop, t.sinks)
+	go t.dispatch(workers)
 	return t
 }
 
 // dispatch TODO(rjeczalik)
-func (t *recursiveTree) dispatch() {
-	for ei := range t.c {
-		dbgprintf("dispatching %v on %q", ei.Event(), ei.Path())
-		go func(ei EventInfo) {
-			nd, ok := node{}, false
-			dir, base := split(ei.Path())
-			fn := func(it node, isbase bool) error {
-				if isbase {
-					nd = it
-				} else {
-					it.Watch.Dispatch(ei, recursive)
-				}
-				return nil
-			}
-			t.rw.RLock()
-			defer t.rw.RUnlock()
-			// Notify recursive watchpoints found on the path.
-			if err := t.root.WalkPath(dir, fn); err != nil {
-				dbgprint("dispatch did not reach leaf:", err)
-				return
-			}
-			// Notify parent watchpoint.
-			nd.Watch.Dispatch(ei, 0)
-			// If leaf watchpoint exists, notify it.
-			if nd, ok = nd.Child[base]; ok {
-				nd.Watch.Dispatch(ei, 0)
-			}
-		}(ei)
+func (t *recursiveTree) dispatch(workers int) {
+	dispatchWith(t.c, workers, func(ei EventInfo) {
+		debug("dispatching", "event", ei.Event(), "path", ei.Path())
+		defer t.cnt.dispatched(ei, time.Now())
+		if ei.Event() == Invalidated {
+			t.rev.invalidate(ei.Path())
+			return
+		}
+		ignore := isIgnoreFile(ei.Path())
+		if ignore {
+			dir, _ := split(ei.Path())
+			t.sinks.Invalidate(dir)
+		}
+		var d deliveries
+		t.rw.RLock()
+		t.dispatchEvent(ei, &d)
+		t.rw.RUnlock()
+		d.Send(t.sinks)
+		if ignore {
+			// Ignore file has changed, reevaluate excluded directories.
+			t.reignore(ei.Path())
+		}
+	})
+}
+
+// dispatchEvent appends to d all channels the ei is to be sent to. It expects
+// t.rw to be locked.
+func (t *recursiveTree) dispatchEvent(ei EventInfo, d *deliveries) {
+	if ei.Event() == Overflow {
+		dispatchOverflow(t.root.nd, ei, d)
+		return
+	}
+	nd, ok := node{}, false
+	dir, base := split(ei.Path())
+	fn := func(it node, isbase bool) error {
+		if isbase {
+			nd = it
+		} else {
+			it.Watch.Dispatch(ei, recursive, d)
+		}
+		return nil
+	}
+	// Notify recursive watchpoints found on the path.
+	if err := t.root.WalkPath(dir, fn); err != nil {
+		debug("dispatch did not reach leaf", "path", ei.Path(), "err", err)
+		return
+	}
+	// Notify parent watchpoint.
+	nd.Watch.Dispatch(ei, 0, d)
+	// If leaf watchpoint exists, notify it.
+	if nd, ok = nd.Child[base]; ok {
+		nd.Watch.Dispatch(ei, 0, d)
 	}
 }
 
 // Watch TODO(rjeczalik)
 func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event) error {
+	return t.WatchWith(path, c, nil, events...)
+}
+
+// WatchWith works like Watch, additionally configuring c with the given
+// options. Nil o means no options.
+func (t *recursiveTree) WatchWith(path string, c chan<- EventInfo, o *watchOptions,
+	events ...Event) (err error) {
 	if c == nil {
 		panic("notify: Watch using nil channel")
 	}
@@ -161,23 +217,184 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 	if len(events) == 0 {
 		return nil
 	}
-	path, isrec, err := cleanpath(path)
+	realpath, isrec, named, err := cleanpathname(path, o != nil && o.byname)
 	if err != nil {
+		if o != nil && o.missing && os.IsNotExist(err) {
+			if e := joinevents(events) &^ (Overflow | Invalidated); e != 0 {
+				return t.rev.await(path, c, o, e)
+			}
+			return nil
+		}
 		return err
 	}
-	eventset := joinevents(events)
+	path = realpath
+	eventset := joinevents(events) &^ (Overflow | Invalidated)
+	if eventset == 0 {
+		// Overflow and Invalidated are always delivered, expanding with them
+		// alone is a nop.
+		return nil
+	}
+	eventset = moveset(t.w, eventset)
 	if isrec {
 		eventset |= recursive
 	}
+	f, err := newFilter(o, path)
+	if err != nil {
+		return err
+	}
+	created, err := t.sinks.Add(c, o)
+	if err != nil {
+		return err
+	}
+	sc := scope{path: path, isrec: isrec, events: eventset &^ recursive, f: f, o: o, name: named}
+	restore := func() {}
+	if isrec {
+		// The filter is registered first, so the watcher skips excluded
+		// directories right away.
+		t.exmu.Lock()
+		restore = t.excl.set(path, c, f)
+		t.exmu.Unlock()
+	}
+	t.rw.Lock()
+	err = t.watch(sc.watched(), isrec, c, eventset, o != nil && o.rollback)
+	if err == nil && isrec && f != nil && f.ign != nil {
+		// Listen on changes to ignore files.
+		if err := t.watch(path, true, t.ign, Create|Remove|Write|Rename|internal, false); err != nil {
+			t.errs.report(&WatchError{Op: "watch", Path: path, Err: err})
+		}
+	}
+	t.rw.Unlock()
+	switch {
+	case err == nil:
+		t.sinks.Scope(c, sc)
+		return nil
+	case created:
+		t.sinks.Del(c)
+	}
+	t.exmu.Lock()
+	restore()
+	t.exmu.Unlock()
+	return err
+}
+
+// excluded reports whether the directory is excluded by every recursive
+// watchpoint it is covered by. It is called by the watcher.
+func (t *recursiveTree) excluded(dir string) bool {
+	t.exmu.RLock()
+	defer t.exmu.RUnlock()
+	return t.excl.excluded(dir)
+}
+
+// reignore watches again the recursive watchpoint covering the given ignore
+// file after it has changed, so the watcher reevaluates which directories are
+// excluded.
+func (t *recursiveTree) reignore(path string) {
+	if _, ok := t.w.(excludeWatcher); !ok {
+		return
+	}
+	t.exmu.RLock()
+	ok := t.excl.ignoring(path)
+	t.exmu.RUnlock()
+	if !ok {
+		return
+	}
+	dir, _ := split(path)
 	t.rw.Lock()
 	defer t.rw.Unlock()
+	var nd node
+	t.root.WalkPath(dir, func(it node, _ bool) error {
+		if watchTotal(it) != 0 && watchIsRecursive(it) {
+			nd = it
+			return errSkip
+		}
+		return nil
+	})
+	if nd.Watch == nil {
+		return
+	}
+	e := watchTotal(nd)
+	if err := t.recrewatch(nd.Name, nd.Name, e, e); err != nil {
+		t.errs.report(&WatchError{Op: "rewatch", Path: nd.Name, Err: err})
+	}
+}
+
+// watchign sets again watchpoints listening on changes to ignore files for
+// recursive watchpoints, which honour them. It expects t.rw to be locked.
+func (t *recursiveTree) watchign() {
+	t.stop(t.ign)
+	var paths []string
+	t.exmu.RLock()
+	for path, fs := range t.excl {
+		for _, f := range fs {
+			if f != nil && f.ign != nil {
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	t.exmu.RUnlock()
+	for _, path := range paths {
+		if err := t.watch(path, true, t.ign, Create|Remove|Write|Rename|internal, false); err != nil {
+			t.errs.report(&WatchError{Op: "watch", Path: path, Err: err})
+		}
+	}
+}
+
+// ignoring reports whether any of the scopes honours ignore files.
+func ignoring(ss scopes) bool {
+	for _, s := range ss {
+		if s.isrec && s.f != nil && s.f.ign != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// recwatch sets a recursive watch on the path. If the watch limit was reached,
+// the partially set watch is either removed, if rollback is true, or kept in
+// place with the error reported. It expects t.rw to be locked.
+func (t *recursiveTree) recwatch(path string, e Event, rollback bool) error {
+	err := t.w.RecursiveWatch(path, e)
+	var lerr *WatchLimitError
+	switch {
+	case err == nil || !errors.As(err, &lerr):
+		return err
+	case rollback:
+		if err := t.w.RecursiveUnwatch(path); err != nil {
+			t.errs.report(&WatchError{Op: "unwatch", Path: path, Err: err})
+		}
+		return err
+	}
+	t.errs.report(&WatchError{Op: "watch", Path: path, Err: err})
+	return nil
+}
+
+// recrewatch changes a recursive watch. If the watch limit was reached, the
+// error is reported and the partially changed watch is kept in place. It
+// expects t.rw to be locked.
+func (t *recursiveTree) recrewatch(oldpath, newpath string, oldevent, newevent Event) error {
+	err := t.w.RecursiveRewatch(oldpath, newpath, oldevent, newevent)
+	var lerr *WatchLimitError
+	if err != nil && errors.As(err, &lerr) {
+		t.errs.report(&WatchError{Op: "rewatch", Path: newpath, Err: err})
+		return nil
+	}
+	return err
+}
+
+// watch sets a watchpoint for c on the path. If rollback is true, a recursive
+// watch which reached the watch limit fails. It expects t.rw to be locked.
+func (t *recursiveTree) watch(path string, isrec bool, c chan<- EventInfo, eventset Event,
+	rollback bool) (err error) {
 	// case 1: cur is a child
 	//
 	// Look for parent watch which already covers the given path.
 	parent := node{}
 	self := false
 	err = t.root.WalkPath(path, func(nd node, isbase bool) error {
-		if watchTotal(nd) != 0 {
+		// Non-recursive watches of watchers, which watch every directory
+		// separately, cover their own directories only.
+		if watchTotal(nd) != 0 && (isbase || !t.perdir || watchIsRecursive(nd)) {
 			parent = nd
 			self = isbase
 			return errSkip
@@ -185,6 +402,10 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 		return nil
 	})
 	cur := t.root.Add(path) // add after the walk, so it's less to traverse
+	if err == nil && parent.Watch != nil && self && isrec && t.perdir && !watchIsRecursive(cur) {
+		// The non-recursive watch of cur becomes a recursive one.
+		return t.fold(cur, c, eventset)
+	}
 	if err == nil && parent.Watch != nil {
 		// Parent watch found. Register inactive watchpoint, so we have enough
 		// information to shrink the eventset on eventual Stop.
@@ -204,7 +425,7 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 			panic("dangling watchpoint: " + parent.Name)
 		default:
 			if isrec || watchIsRecursive(parent) {
-				err = t.w.RecursiveRewatch(parent.Name, parent.Name, diff[0], diff[1])
+				err = t.recrewatch(parent.Name, parent.Name, diff[0], diff[1])
 			} else {
 				err = t.w.Rewatch(parent.Name, diff[0], diff[1])
 			}
@@ -224,21 +445,19 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 	// case 2: cur is new parent
 	//
 	// Look for children nodes, unwatch n-1 of them and rewatch the last one.
+	// Non-recursive watches of watchers, which watch every directory
+	// separately, do not take over the children.
 	var children []node
-	fn := func(nd node) error {
-		if len(nd.Watch) == 0 {
-			return nil
-		}
-		children = append(children, nd)
-		return errSkip
+	if isrec || !t.perdir {
+		children = t.holders(cur)
 	}
-	switch must(cur.Walk(fn)); len(children) {
+	switch len(children) {
 	case 0:
 		// no child watches, cur holds a new watch
 	case 1:
 		watchAdd(cur, c, eventset) // TODO(rjeczalik): update cache c subtree root?
 		watchCopy(children[0], cur)
-		err = t.w.RecursiveRewatch(children[0].Name, cur.Name, watchTotal(children[0]),
+		err = t.recrewatch(children[0].Name, cur.Name, watchTotal(children[0]),
 			watchTotal(cur))
 		if err != nil {
 			// Clean inactive watchpoint. The c chan did not exist before.
@@ -254,27 +473,14 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 			watchCopy(nd, cur)
 		}
 		// Watch parent subtree.
-		if err = t.w.RecursiveWatch(cur.Name, watchTotal(cur)); err != nil {
+		if err = t.recwatch(cur.Name, watchTotal(cur), rollback); err != nil {
 			// Clean inactive watchpoint. The c chan did not exist before.
 			cur.Child[""] = node{}
 			delete(cur.Watch, c)
 			return err
 		}
 		// Unwatch children subtrees.
-		var e error
-		for _, nd := range children {
-			if watchIsRecursive(nd) {
-				e = t.w.RecursiveUnwatch(nd.Name)
-			} else {
-				e = t.w.Unwatch(nd.Name)
-			}
-			if e != nil {
-				err = nonil(err, e)
-				// TODO(rjeczalik): child is still watched, warn all its watchpoints
-				// about possible duplicate events via Error event
-			}
-		}
-		return err
+		return t.unwatchall(children)
 	}
 	// case 3: cur is new, alone node
 	switch diff := watchAdd(cur, c, eventset); {
@@ -283,7 +489,7 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 		panic("watch requested but no parent watchpoint found: " + cur.Name)
 	case diff[0] == 0:
 		if isrec {
-			err = t.w.RecursiveWatch(cur.Name, diff[1])
+			err = t.recwatch(cur.Name, diff[1], rollback)
 		} else {
 			err = t.w.Watch(cur.Name, diff[1])
 		}
@@ -298,57 +504,312 @@ func (t *recursiveTree) Watch(path string, c chan<- EventInfo, events ...Event)
 	return nil
 }
 
+// holders gives the descendants of nd, which hold watches of their own. It
+// expects t.rw to be locked.
+func (t *recursiveTree) holders(nd node) (nds []node) {
+	must(nd.Walk(func(it node) error {
+		if it.Name == nd.Name || len(it.Watch) == 0 {
+			return nil
+		}
+		nds = append(nds, it)
+		if t.perdir && !watchIsRecursive(it) {
+			// Non-recursive watch of it covers its own directory only.
+			return nil
+		}
+		return errSkip
+	}))
+	return nds
+}
+
+// unwatchall unwatches the given holders, whose watchpoints were taken over by
+// a recursive watch of their parent. It expects t.rw to be locked.
+func (t *recursiveTree) unwatchall(nds []node) (err error) {
+	for _, nd := range nds {
+		var e error
+		if watchIsRecursive(nd) {
+			e = t.w.RecursiveUnwatch(nd.Name)
+		} else {
+			e = t.w.Unwatch(nd.Name)
+		}
+		// Watchers, which watch every directory separately, may have handed
+		// the directories over to the parent watch already.
+		if e != nil && !errors.Is(e, ErrNotWatched) {
+			err = nonil(err, e)
+			// TODO(rjeczalik): child is still watched, warn all its watchpoints
+			// about possible duplicate events via Error event
+		}
+		if t.perdir {
+			delete(nd.Child, "")
+		}
+	}
+	return err
+}
+
+// fold makes the non-recursive watch of nd a recursive one, which takes over
+// the watches of its descendants. It expects t.rw to be locked.
+func (t *recursiveTree) fold(nd node, c chan<- EventInfo, eventset Event) error {
+	before, old := watchTotal(nd), nd.Watch[c]
+	watchAdd(nd, c, eventset)
+	nds := t.holders(nd)
+	for _, it := range nds {
+		watchCopy(it, nd)
+	}
+	if err := t.recrewatch(nd.Name, nd.Name, before, watchTotal(nd)); err != nil {
+		delete(nd.Child, "")
+		nd.Watch.Del(c, all)
+		if old != 0 {
+			nd.Watch.Add(c, old)
+		}
+		return err
+	}
+	return t.unwatchall(nds)
+}
+
+// split hands the recursive watch of nd, whose own watchpoints are no longer
+// recursive, over to its descendants and makes the watch of nd a non-recursive
+// one. It is the reverse of fold. It expects t.rw to be locked.
+func (t *recursiveTree) split(nd node, before Event) {
+	delete(nd.Child, "")
+	must(nd.Walk(func(it node) error {
+		if it.Name == nd.Name || len(it.Watch) == 0 {
+			delete(it.Child, "")
+			return nil
+		}
+		if !it.Watch.IsRecursive() {
+			delete(it.Child, "")
+			if err := t.w.Watch(it.Name, it.Watch.Total()); err != nil {
+				t.errs.report(&WatchError{Op: "watch", Path: it.Name, Err: err})
+			}
+			return nil
+		}
+		delete(it.Child, "")
+		must(it.Walk(func(d node) error {
+			if d.Name == it.Name {
+				return nil
+			}
+			delete(d.Child, "")
+			for c, e := range d.Watch {
+				if c != nil {
+					watchAddInactive(it, c, e)
+				}
+			}
+			return nil
+		}))
+		if err := t.recwatch(it.Name, watchTotal(it), false); err != nil {
+			t.errs.report(&WatchError{Op: "watch", Path: it.Name, Err: err})
+		}
+		return errSkip
+	}))
+	var err error
+	if len(nd.Watch) == 0 {
+		err = t.w.Unwatch(nd.Name)
+	} else {
+		err = t.w.Rewatch(nd.Name, before, nd.Watch.Total())
+	}
+	if err != nil {
+		t.errs.report(&WatchError{Op: "rewatch", Path: nd.Name, Err: err})
+	}
+}
+
+// rewatch shrinks the watch of nd, which was watched with the before events,
+// after watchpoints were removed from it. If rescan is true, a recursive watch
+// is set again even if its events did not change. It expects t.rw to be
+// locked.
+func (t *recursiveTree) rewatch(nd node, before Event, wasrec, rescan bool) {
+	var err error
+	op, after, isrec := "rewatch", watchTotal(nd), watchIsRecursive(nd)
+	switch {
+	case after == 0:
+		op = "unwatch"
+		if isrec {
+			err = t.w.RecursiveUnwatch(nd.Name)
+		} else {
+			err = t.w.Unwatch(nd.Name)
+		}
+		if errors.Is(err, ErrNotWatched) {
+			// Watches of removed paths may be gone already.
+			err = nil
+		}
+	case t.perdir && isrec && !nd.Watch.IsRecursive():
+		// Only inactive watchpoints of descendants keep nd recursive.
+		t.split(nd, before)
+	case before == after && wasrec == isrec && !(isrec && rescan):
+		// Removing the watchpoints does not require shrinking the watch.
+	case isrec:
+		err = t.w.RecursiveRewatch(nd.Name, nd.Name, before, after)
+	default:
+		err = t.w.Rewatch(nd.Name, before, after)
+	}
+	if err != nil {
+		t.errs.report(&WatchError{Op: op, Path: nd.Name, Err: err})
+	}
+}
+
 // Stop TODO(rjeczalik)
 //
 // TODO(rjeczalik): Split parent watchpoint - transfer watches to children
-// if parent is no longer needed. This carries a risk that underlying
-// watcher calls could fail - reconsider if it's worth the effort.
+// if parent is no longer needed, also for natively recursive watchers. This
+// carries a risk that underlying watcher calls could fail - reconsider if it's
+// worth the effort.
 func (t *recursiveTree) Stop(c chan<- EventInfo) {
-	var err error
-	fn := func(nd node) (e error) {
-		diff := watchDel(nd, c, all)
-		switch {
-		case diff == none && watchTotal(nd) == 0:
+	t.rev.stopc(c)
+	ign := ignoring(t.sinks.Scopes(c))
+	t.sinks.Del(c)
+	t.exmu.Lock()
+	t.excl.stop(c)
+	t.exmu.Unlock()
+	t.rw.Lock()
+	t.stop(c)
+	if ign {
+		t.watchign()
+	}
+	t.rw.Unlock()
+}
+
+// Unwatch removes the events for c from the watchpoint on the given path.
+func (t *recursiveTree) Unwatch(path string, c chan<- EventInfo, events Event) error {
+	// Watchpoints of removed paths can be unwatched as well.
+	path, isrec, err := cleanpathgone(path)
+	if err != nil {
+		return err
+	}
+	events = moveset(t.w, events&^(Overflow|Invalidated))
+	if t.rev.unwatch(path, isrec, c, events) {
+		return nil
+	}
+	if _, ok := t.sinks.Scopes(c).get(path, isrec); !ok {
+		return &WatchError{Op: "unwatch", Path: path, Err: ErrNotWatched}
+	}
+	if !t.unscope(path, isrec, c, events) {
+		t.sinks.Del(c)
+	}
+	return nil
+}
+
+// drop removes the watchpoint of the given kind on the path for c, whose path
+// is gone. Unlike Unwatch, it keeps c registered.
+func (t *recursiveTree) drop(path string, isrec bool, c chan<- EventInfo) error {
+	if _, ok := t.sinks.Scopes(c).get(path, isrec); !ok {
+		return ErrNotWatched
+	}
+	t.unscope(path, isrec, c, all)
+	return nil
+}
+
+// unscope removes the events for c from the watchpoint of the given kind on
+// the path and reports whether c has any watchpoints left. The watch holding
+// the watchpoint is shrunk in place, other watchpoints of c are not disturbed.
+func (t *recursiveTree) unscope(path string, isrec bool, c chan<- EventInfo, events Event) bool {
+	ign := ignoring(t.sinks.Scopes(c))
+	sc, _ := t.sinks.Scopes(c).get(path, isrec)
+	left := t.sinks.Unscope(c, path, isrec, events)
+	// Events c keeps listening on in the watched directory.
+	dir, want := sc.watched(), Event(0)
+	for _, s := range t.sinks.Scopes(c) {
+		if s.watched() == dir {
+			want |= s.events
+			if s.isrec {
+				want |= recursive
+			}
+		}
+	}
+	_, ok := t.sinks.Scopes(c).get(path, true)
+	rescan := isrec && !ok
+	if rescan {
+		t.exmu.Lock()
+		t.excl.del(path, c)
+		t.exmu.Unlock()
+	}
+	t.rw.Lock()
+	t.shrink(dir, c, want, rescan)
+	if ign {
+		t.watchign()
+	}
+	t.rw.Unlock()
+	return left
+}
+
+// shrink narrows the watchpoint of c on the path down to the want events and
+// shrinks the watch, which holds it. It expects t.rw to be locked.
+func (t *recursiveTree) shrink(path string, c chan<- EventInfo, want Event, rescan bool) {
+	var holder node
+	err := t.root.WalkPath(path, func(nd node, isbase bool) error {
+		if watchTotal(nd) != 0 && (isbase || watchIsRecursive(nd)) {
+			holder = nd
+			return errSkip
+		}
+		return nil
+	})
+	nd, e := t.root.Get(path)
+	if err != nil || e != nil || holder.Watch == nil || nd.Watch[c]&^want == 0 {
+		return
+	}
+	before, wasrec := watchTotal(holder), watchIsRecursive(holder)
+	nd.Watch.Del(c, nd.Watch[c]&^want)
+	if holder.Name != nd.Name {
+		// Inactive watchpoint of c within the holder is the sum of the
+		// watchpoints of c below it.
+		e := Event(0)
+		must(holder.Walk(func(it node) error {
+			if it.Name != holder.Name {
+				e |= it.Watch[c]
+			}
+			return nil
+		}))
+		wp := holder.Child[""].Watch
+		wp.Del(c, all)
+		if e != 0 {
+			wp.Add(c, e)
+		}
+	}
+	t.rewatch(holder, before, wasrec, rescan)
+}
+
+// stop removes all watchpoints registered for c. It expects t.rw to be locked.
+func (t *recursiveTree) stop(c chan<- EventInfo) {
+	fn := func(nd node) error {
+		before, wasrec := watchTotal(nd), watchIsRecursive(nd)
+		if before == 0 {
 			// TODO(rjeczalik): There's no watchpoints deeper in the tree,
 			// probably we should remove the nodes as well.
 			return nil
-		case diff == none:
-			// Removing c from nd does not require shrinking its eventset.
-		case diff[1] == 0:
-			if watchIsRecursive(nd) {
-				e = t.w.RecursiveUnwatch(nd.Name)
-			} else {
-				e = t.w.Unwatch(nd.Name)
-			}
-		default:
-			if watchIsRecursive(nd) {
-				e = t.w.RecursiveRewatch(nd.Name, nd.Name, diff[0], diff[1])
-			} else {
-				e = t.w.Rewatch(nd.Name, diff[0], diff[1])
-			}
 		}
-		fn := func(nd node) error {
+		if !wasrec {
+			// Non-recursive watch covers its own directory only.
 			watchDel(nd, c, all)
+			t.rewatch(nd, before, wasrec, false)
 			return nil
 		}
-		err = nonil(err, e, nd.Walk(fn))
-		// TODO(rjeczalik): if e != nil store dummy chan in nd.Watch just to
-		// retry un/rewatching next time and/or let the user handle the failure
-		// vie Error event?
+		must(nd.Walk(func(nd node) error {
+			watchDel(nd, c, all)
+			return nil
+		}))
+		t.rewatch(nd, before, wasrec, false)
+		// TODO(rjeczalik): if rewatch failed store dummy chan in nd.Watch just
+		// to retry un/rewatching next time.
 		return errSkip
 	}
-	t.rw.Lock()
-	e := t.root.Walk("", fn) // TODO(rjeczalik): use max root per c
-	t.rw.Unlock()
-	if e != nil {
-		err = nonil(err, e)
-	}
-	dbgprintf("Stop(%p) error: %v\n", c, err)
+	err := t.root.Walk("", fn) // TODO(rjeczalik): use max root per c
+	debug("stopped", chanattr(c), "err", err)
 }
 
 // Close TODO(rjeczalik)
 func (t *recursiveTree) Close() error {
+	t.rev.close()
 	err := t.w.Close()
 	close(t.c)
+	t.sinks.Close()
 	return err
 }
+
+// Stats gives a snapshot of the tree statistics.
+func (t *recursiveTree) Stats() Statistics {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return t.cnt.stats(countnodes(t.root.nd), t.sinks)
+}
+
+// Dropped gives the number of events dropped for c.
+func (t *recursiveTree) Dropped(c chan<- EventInfo) uint64 {
+	return t.sinks.Dropped(c)
+}
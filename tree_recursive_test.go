@@ -519,3 +519,131 @@ func TestRecursiveTree_Windows(t *testing.T) {
 
 	n.ExpectTreeEvents(events[:], ch)
 }
+
+func TestRecursiveTreeWatches(t *testing.T) {
+	n := NewRecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(2)
+
+	n.Watch("src/github.com/rjeczalik/fs/cmd/...", ch[0], Create)
+	n.Watch("src/github.com/rjeczalik/fs/...", ch[1], Remove)
+
+	// The watcher holds a watch only for the path of the merged watch.
+	rt := n.tree.(*recursiveTree)
+	rt.cnt.sw = watchedPaths{n.w.clean("src/github.com/rjeczalik/fs"): true}
+	wl := rt.Watches()
+	if len(wl) != 2 {
+		t.Fatalf("want 2 watches; got %v", wl)
+	}
+	// The former watch got merged into the latter one.
+	if !wl[0].Kernel || wl[0].Events != Remove || !wl[0].Recursive {
+		t.Fatalf("want recursive, kernel-backed Remove watch; got %v", wl[0])
+	}
+	if wl[1].Kernel || wl[1].Events != Create || !wl[1].Recursive {
+		t.Fatalf("want recursive Create watch not backed by kernel; got %v", wl[1])
+	}
+}
+
+func TestRecursiveTreeUnwatch(t *testing.T) {
+	n := NewRecursiveTreeTest(t, "testdata/vfs.txt")
+
+	ch := NewChans(1)
+
+	calls := [...]RCase{
+		// i=0
+		{
+			Call: Call{
+				F: FuncWatch,
+				P: "src/github.com/rjeczalik/fs/...",
+				C: ch[0],
+				E: Create | Remove,
+			},
+			Record: []Call{
+				{
+					F: FuncRecursiveWatch,
+					P: "src/github.com/rjeczalik/fs",
+					E: Create | Remove,
+				},
+			},
+		},
+		// i=1
+		{
+			Call: Call{
+				F: FuncWatch,
+				P: "src/github.com/rjeczalik/fs/cmd/gotree",
+				C: ch[0],
+				E: Write,
+			},
+			Record: []Call{
+				{
+					F:  FuncRecursiveRewatch,
+					P:  "src/github.com/rjeczalik/fs",
+					NP: "src/github.com/rjeczalik/fs",
+					E:  Create | Remove,
+					NE: Create | Remove | Write,
+				},
+			},
+		},
+		// i=2
+		{
+			Call: Call{
+				F: FuncUnwatch,
+				P: "src/github.com/rjeczalik/fs/...",
+				C: ch[0],
+				E: Remove,
+			},
+			Record: []Call{
+				{
+					F:  FuncRecursiveRewatch,
+					P:  "src/github.com/rjeczalik/fs",
+					NP: "src/github.com/rjeczalik/fs",
+					E:  Create | Remove | Write,
+					NE: Create | Write,
+				},
+			},
+		},
+		// i=3
+		{
+			Call: Call{
+				F: FuncUnwatch,
+				P: "src/github.com/rjeczalik/fs/cmd/gotree",
+				C: ch[0],
+				E: Write,
+			},
+			Record: []Call{
+				{
+					F:  FuncRecursiveRewatch,
+					P:  "src/github.com/rjeczalik/fs",
+					NP: "src/github.com/rjeczalik/fs",
+					E:  Create | Write,
+					NE: Create,
+				},
+			},
+		},
+	}
+
+	n.ExpectRecordedCalls(calls[:])
+
+	events := [...]TCase{
+		// i=0
+		{
+			Event:    Call{P: "src/github.com/rjeczalik/fs/cmd/gotree/main.go", E: Create},
+			Receiver: Chans{ch[0]},
+		},
+		// i=1
+		{
+			Event:    Call{P: "src/github.com/rjeczalik/fs/cmd/gotree/main.go", E: Write},
+			Receiver: nil,
+		},
+	}
+
+	n.ExpectTreeEvents(events[:], ch)
+}
+
+// watchedPaths implements statWatcher interface, telling which paths are
+// watched.
+type watchedPaths map[string]bool
+
+func (p watchedPaths) Watches() int             { return len(p) }
+func (watchedPaths) Read() uint64               { return 0 }
+func (p watchedPaths) Watched(path string) bool { return p[path] }
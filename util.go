@@ -61,6 +61,52 @@ func cleanpath(path string) (realpath string, isrec bool, err error) {
 	return path, isrec, nil
 }
 
+// cleanpathgone works like cleanpath, but it does not require the path to
+// exist. The missing part of the path is joined with the canonical form of its
+// nearest existing parent.
+func cleanpathgone(path string) (realpath string, isrec bool, err error) {
+	realpath, isrec, err = cleanpath(path)
+	if !os.IsNotExist(err) {
+		return realpath, isrec, err
+	}
+	if path, err = filepath.Abs(strings.TrimSuffix(path, "...")); err != nil {
+		return "", false, err
+	}
+	for dir, rest := filepath.Dir(path), filepath.Base(path); ; {
+		switch p, err := canonical(dir); {
+		case err == nil:
+			return filepath.Join(p, rest), isrec, nil
+		case !os.IsNotExist(err) || dir == filepath.Dir(dir):
+			return "", false, err
+		}
+		dir, rest = filepath.Dir(dir), filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// cleanpathname works like cleanpath, but if byname is true, it also accepts
+// a file, which does not exist, in an existing directory. It reports whether the
+// path is to be watched by its name, which is never the case for recursive
+// paths and directories.
+func cleanpathname(path string, byname bool) (realpath string, isrec, named bool, err error) {
+	if !byname || strings.HasSuffix(path, "...") {
+		realpath, isrec, err = cleanpath(path)
+		return realpath, isrec, false, err
+	}
+	if realpath, _, err = cleanpathgone(path); err != nil {
+		return "", false, false, err
+	}
+	switch fi, err := os.Stat(realpath); {
+	case err == nil:
+		return realpath, false, !fi.IsDir(), nil
+	case !os.IsNotExist(err):
+		return "", false, false, err
+	}
+	if _, err = os.Stat(filepath.Dir(realpath)); err != nil {
+		return "", false, false, err
+	}
+	return realpath, false, true, nil
+}
+
 // canonical resolves any symlink in the given path and returns it in a clean form.
 // It expects the path to be absolute. It fails to resolve circular symlinks by
 // maintaining a simple iteration limit.
@@ -4,13 +4,7 @@
 
 package notify
 
-import "errors"
-
-var (
-	errAlreadyWatched  = errors.New("path is already watched")
-	errNotWatched      = errors.New("path is not being watched")
-	errInvalidEventSet = errors.New("invalid event set provided")
-)
+import "time"
 
 // Watcher is a intermediate interface for wrapping inotify, ReadDirChangesW,
 // FSEvents, kqueue and poller implementations.
@@ -47,6 +41,11 @@ type watcher interface {
 // RecursiveWatcher is an interface for a Watcher for those OS, which do support
 // recursive watching over directories.
 type recursiveWatcher interface {
+	// RecursiveWatch requests a recursive watch-point for the given path and
+	// event set. Watchers, which watch every directory separately, may fail
+	// with *WatchLimitError leaving the watch-point set up partially - it is
+	// up to Tree to either keep it in place or remove it. The same applies to
+	// RecursiveRewatch.
 	RecursiveWatch(path string, event Event) error
 
 	// RecursiveUnwatch removes a recursive watch-point given by the path. For
@@ -83,3 +82,65 @@ type recursiveWatcher interface {
 	// non-recursive to the recursive one.
 	RecursiveRewatch(oldpath, newpath string, oldevent, newevent Event) error
 }
+
+// errorWatcher is an interface for a Watcher, which is able to report errors
+// that happen asynchronously, after any of the Watcher methods has returned.
+type errorWatcher interface {
+	// SetErrorHandler sets a function, which is called for every asynchronous
+	// error. It is guaranteed Tree calls SetErrorHandler before any other
+	// Watcher method.
+	SetErrorHandler(fn func(error))
+}
+
+// moveWatcher is an interface for a Watcher, which is able to pair rename events
+// into Move events. Tree degrades Move to Create, Remove and Rename events for
+// watchers which do not implement it.
+type moveWatcher interface {
+	// SetMoveWindow sets the maximum time to wait for the other rename event
+	// of a pair. It is guaranteed Tree calls SetMoveWindow before any other
+	// Watcher method.
+	SetMoveWindow(d time.Duration)
+}
+
+// orderedWatcher is an interface for a Watcher, which by default processes
+// events concurrently and therefore may send them out of order.
+type orderedWatcher interface {
+	// SetOrdered makes the watcher send events in the order they were
+	// reported by the OS. It is guaranteed Tree calls SetOrdered before any
+	// other Watcher method.
+	SetOrdered()
+}
+
+// statWatcher is an interface for a Watcher, which is able to tell what it
+// watches. It is guaranteed Tree calls its methods with the tree locked.
+type statWatcher interface {
+	// Watches gives the number of watches currently held by the watcher.
+	Watches() int
+
+	// Watched reports whether the watcher holds a watch for the path.
+	Watched(path string) bool
+
+	// Read gives the number of events the watcher read from the OS. It is
+	// safe to be called from any goroutine.
+	Read() uint64
+}
+
+// excludeWatcher is an interface for a recursiveWatcher, which watches every
+// directory of a recursive watch-point separately and is able to skip the ones,
+// which are excluded.
+type excludeWatcher interface {
+	// SetExcluded sets a function, which reports whether the directory is
+	// excluded by every watch-point covering it. The function is safe to be
+	// called from any goroutine of the watcher. It is guaranteed Tree calls
+	// SetExcluded before any other Watcher method.
+	SetExcluded(fn func(dir string) bool)
+}
+
+// rescanWatcher is an interface for a recursiveWatcher, which is able to
+// reconcile its recursive watch-points with the filesystem after an overflow.
+type rescanWatcher interface {
+	// SetRescan makes the watcher rescan recursive watch-points after it
+	// reported Overflow. It is guaranteed Tree calls SetRescan before any
+	// other Watcher method.
+	SetRescan()
+}
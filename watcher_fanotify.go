@@ -0,0 +1,429 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package notify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Fanotify constants, which are not defined by golang.org/x/sys/unix.
+const (
+	fanCloexec         = 0x1
+	fanNonblock        = 0x2
+	fanUnlimitedQueue  = 0x10
+	fanReportDFIDName  = 0xc00 // FAN_REPORT_DIR_FID | FAN_REPORT_NAME
+	fanMarkAdd         = 0x1
+	fanMarkRemove      = 0x2
+	fanMarkFilesystem  = 0x100
+	fanModify          = 0x2
+	fanMovedFrom       = 0x40
+	fanMovedTo         = 0x80
+	fanCreate          = 0x100
+	fanDelete          = 0x200
+	fanQOverflow       = 0x4000
+	fanOndir           = 0x40000000
+	fanInfoDFIDName    = 2  // FAN_EVENT_INFO_TYPE_DFID_NAME
+	fanMetadataLen     = 24 // sizeof(struct fanotify_event_metadata)
+	fanInfoHeaderLen   = 4  // sizeof(struct fanotify_event_info_header)
+	fanMask            = fanModify | fanMovedFrom | fanMovedTo | fanCreate | fanDelete | fanOndir
+	fanEventBufferSize = 64 * (fanMetadataLen + fanInfoHeaderLen + 8 + 8 + unix.PathMax)
+)
+
+// fanwatch is a path watched by fanotify.
+type fanwatch struct {
+	e     Event
+	isrec bool
+	fsid  unix.Fsid
+}
+
+// fanfs is a filesystem marked by fanotify.
+type fanfs struct {
+	fd int // descriptor used for resolving file handles
+	n  int // number of watches within the filesystem
+}
+
+// fanotify implements watcher and recursiveWatcher interfaces using fanotify
+// filesystem marks. A single mark covers a whole filesystem, events are
+// filtered by the watched paths in userspace, therefore a recursive watch
+// is set up at once, regardless of the size of the directory tree, and never
+// misses directories created within it.
+//
+// Fanotify requires CAP_SYS_ADMIN for filesystem marks and CAP_DAC_READ_SEARCH
+// for resolving paths of events. Only filesystems, which support file handles,
+// can be watched.
+type fanotify struct {
+	mu     sync.Mutex           // protects m, fs and report
+	m      map[string]*fanwatch // watched paths
+	fs     map[unix.Fsid]*fanfs // marked filesystems
+	fd     int                  // fanotify descriptor
+	f      *os.File             // pollable fanotify descriptor
+	c      chan<- EventInfo     // event dispatcher channel
+	report func(error)          // asynchronous errors handler
+	once   sync.Once            // closes f
+	done   chan struct{}        // closed by Close
+	wg     sync.WaitGroup       // waits for the reading goroutine
+	reads  atomic.Uint64        // number of events read from fanotify
+}
+
+// newFanotify creates a fanotify watcher. It fails if fanotify is not supported
+// by the kernel or the process lacks the needed capabilities.
+func newFanotify(c chan<- EventInfo) (watcher, error) {
+	// FAN_UNLIMITED_QUEUE requires CAP_SYS_ADMIN, which filesystem marks
+	// require as well, so the lack of it is detected early.
+	flags := fanCloexec | fanNonblock | fanUnlimitedQueue | fanReportDFIDName
+	fd, _, errno := unix.Syscall(unix.SYS_FANOTIFY_INIT, uintptr(flags), unix.O_RDONLY|unix.O_LARGEFILE, 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("fanotify_init", errno)
+	}
+	f := &fanotify{
+		m:      make(map[string]*fanwatch),
+		fs:     make(map[unix.Fsid]*fanfs),
+		fd:     int(fd),
+		f:      os.NewFile(fd, "fanotify"),
+		c:      c,
+		report: func(error) {},
+		done:   make(chan struct{}),
+	}
+	f.wg.Add(1)
+	go f.loop()
+	return f, nil
+}
+
+// SetErrorHandler implements notify.errorWatcher interface. The reading
+// goroutine is running already, hence f.report is guarded by f.mu.
+func (f *fanotify) SetErrorHandler(fn func(error)) {
+	f.mu.Lock()
+	f.report = fn
+	f.mu.Unlock()
+}
+
+// Watches implements notify.statWatcher interface.
+func (f *fanotify) Watches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.m)
+}
+
+// Read implements notify.statWatcher interface.
+func (f *fanotify) Read() uint64 {
+	return f.reads.Load()
+}
+
+// Watched implements notify.statWatcher interface.
+func (f *fanotify) Watched(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.m[path]
+	return ok
+}
+
+// Watch implements notify.watcher interface.
+func (f *fanotify) Watch(path string, e Event) error {
+	return f.watch(path, e, false)
+}
+
+// RecursiveWatch implements notify.recursiveWatcher interface.
+func (f *fanotify) RecursiveWatch(path string, e Event) error {
+	return f.watch(path, e, true)
+}
+
+// watch adds the path to the watched ones, marking its filesystem if it was
+// not marked yet.
+func (f *fanotify) watch(path string, e Event, isrec bool) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.m[path]; ok {
+		return ErrAlreadyWatched
+	}
+	fs, ok := f.fs[st.Fsid]
+	if !ok {
+		// The descriptor must not be opened with O_PATH, since neither
+		// fanotify_mark nor open_by_handle_at accept such ones.
+		dir := path
+		if st, err := os.Stat(path); err == nil && !st.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return &os.PathError{Op: "open", Path: dir, Err: err}
+		}
+		if err := f.mark(fanMarkAdd, fd); err != nil {
+			unix.Close(fd)
+			return err
+		}
+		fs = &fanfs{fd: fd}
+		f.fs[st.Fsid] = fs
+	}
+	fs.n++
+	f.m[path] = &fanwatch{e: e, isrec: isrec, fsid: st.Fsid}
+	debug("fanotify: watched", "path", path, "event", e, "recursive", isrec)
+	return nil
+}
+
+// mark adds or removes the mark of the filesystem the directory referred to by
+// fd resides on.
+func (f *fanotify) mark(flags, fd int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_FANOTIFY_MARK, uintptr(f.fd), uintptr(flags|fanMarkFilesystem),
+		fanMask, uintptr(fd), 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("fanotify_mark", errno)
+	}
+	return nil
+}
+
+// Rewatch implements notify.watcher interface. It makes the watch of the path
+// non-recursive.
+func (f *fanotify) Rewatch(path string, _, e Event) error {
+	return f.rewatch(path, path, e, false)
+}
+
+// RecursiveRewatch implements notify.recursiveWatcher interface.
+func (f *fanotify) RecursiveRewatch(oldpath, newpath string, _, e Event) error {
+	return f.rewatch(oldpath, newpath, e, true)
+}
+
+// rewatch sets the event set of the watch and moves it from oldpath to newpath.
+// Both paths reside on the same filesystem, since newpath is always a parent of
+// oldpath or the other way round.
+func (f *fanotify) rewatch(oldpath, newpath string, e Event, isrec bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fw, ok := f.m[oldpath]
+	if !ok {
+		return ErrNotWatched
+	}
+	if _, ok := f.m[newpath]; ok && oldpath != newpath {
+		return ErrAlreadyWatched
+	}
+	delete(f.m, oldpath)
+	fw.e, fw.isrec = e, isrec
+	f.m[newpath] = fw
+	return nil
+}
+
+// Unwatch implements notify.watcher interface.
+func (f *fanotify) Unwatch(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fw, ok := f.m[path]
+	if !ok {
+		return ErrNotWatched
+	}
+	delete(f.m, path)
+	debug("fanotify: unwatched", "path", path)
+	fs := f.fs[fw.fsid]
+	if fs.n--; fs.n != 0 {
+		return nil
+	}
+	delete(f.fs, fw.fsid)
+	defer unix.Close(fs.fd)
+	return f.mark(fanMarkRemove, fs.fd)
+}
+
+// RecursiveUnwatch implements notify.recursiveWatcher interface.
+func (f *fanotify) RecursiveUnwatch(path string) error {
+	return f.Unwatch(path)
+}
+
+// Close implements notify.watcher interface. When it returns, fanotify sends
+// no more events.
+func (f *fanotify) Close() (err error) {
+	f.once.Do(func() {
+		close(f.done)
+		err = f.f.Close()
+		f.wg.Wait()
+		f.mu.Lock()
+		for _, fs := range f.fs {
+			unix.Close(fs.fd)
+		}
+		f.m, f.fs = make(map[string]*fanwatch), make(map[unix.Fsid]*fanfs)
+		f.mu.Unlock()
+	})
+	return
+}
+
+// loop reads fanotify events, until the descriptor is closed.
+func (f *fanotify) loop() {
+	defer f.wg.Done()
+	buf := make([]byte, fanEventBufferSize)
+	for {
+		n, err := f.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				f.mu.Lock()
+				report := f.report
+				f.mu.Unlock()
+				report(os.NewSyscallError("read", err))
+			}
+			return
+		}
+		for _, ei := range f.events(buf[:n]) {
+			select {
+			case f.c <- ei:
+			case <-f.done:
+				return
+			}
+		}
+	}
+}
+
+// events parses the events read from fanotify descriptor and gives the ones,
+// which are within watched paths.
+func (f *fanotify) events(buf []byte) (events []EventInfo) {
+	ne := binary.NativeEndian
+	for len(buf) >= fanMetadataLen {
+		n := int(ne.Uint32(buf))
+		if n < fanMetadataLen || n > len(buf) {
+			break
+		}
+		mlen, mask, fd := int(ne.Uint16(buf[6:])), ne.Uint64(buf[8:]), int32(ne.Uint32(buf[16:]))
+		if fd >= 0 {
+			// Not expected for events reporting file handles.
+			unix.Close(int(fd))
+		}
+		f.reads.Add(1)
+		if mask&fanQOverflow != 0 {
+			events = append(events, &synthetic{e: Overflow})
+		} else {
+			events = append(events, f.event(mask, buf[mlen:n])...)
+		}
+		buf = buf[n:]
+	}
+	return events
+}
+
+// event translates a single fanotify event with the given info records to the
+// notify ones, which are within watched paths.
+func (f *fanotify) event(mask uint64, info []byte) []EventInfo {
+	ne := binary.NativeEndian
+	for len(info) >= fanInfoHeaderLen {
+		typ, n := info[0], int(ne.Uint16(info[2:]))
+		if n < fanInfoHeaderLen || n > len(info) {
+			return nil
+		}
+		if typ == fanInfoDFIDName {
+			return f.resolve(mask, info[fanInfoHeaderLen:n])
+		}
+		info = info[n:]
+	}
+	return nil
+}
+
+// fanevents maps fanotify masks to events. Fanotify merges events for the same
+// file, which were not read yet, they are split in the order they most likely
+// happened.
+var fanevents = []struct {
+	mask uint64
+	e    Event
+}{
+	{fanCreate, Create},
+	{fanMovedTo, Create},
+	{fanModify, Write},
+	{fanMovedFrom, Rename},
+	{fanDelete, Remove},
+}
+
+// resolve gives the events for the given DFID_NAME record, which consists of
+// filesystem ID, file handle of the parent directory and the name of the file.
+func (f *fanotify) resolve(mask uint64, rec []byte) (events []EventInfo) {
+	ne := binary.NativeEndian
+	if len(rec) < 16 {
+		return nil
+	}
+	fsid := unix.Fsid{Val: [2]int32{int32(ne.Uint32(rec)), int32(ne.Uint32(rec[4:]))}}
+	hlen := 8 + int(ne.Uint32(rec[8:])) // struct file_handle
+	if 8+hlen > len(rec) {
+		return nil
+	}
+	name := rec[8+hlen:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	// The handle is copied, so it is properly aligned.
+	handle := append([]byte(nil), rec[8:8+hlen]...)
+	// The handle is resolved without holding f.mu against a duplicate of the
+	// descriptor of the filesystem, which Unwatch may close meanwhile.
+	f.mu.Lock()
+	fs, ok := f.fs[fsid]
+	mountfd := -1
+	if ok {
+		mountfd, _ = unix.FcntlInt(uintptr(fs.fd), unix.F_DUPFD_CLOEXEC, 0)
+	}
+	f.mu.Unlock()
+	if mountfd < 0 {
+		return nil
+	}
+	dir, err := openByHandle(mountfd, handle)
+	unix.Close(mountfd)
+	if err != nil {
+		// The directory is gone already.
+		return nil
+	}
+	path := dir
+	if len(name) != 0 && string(name) != "." {
+		path = filepath.Join(dir, string(name))
+	}
+	for _, fe := range fanevents {
+		if mask&fe.mask != 0 && f.matches(path, fe.e) {
+			events = append(events, &synthetic{e: fe.e, p: path, d: mask&fanOndir != 0})
+		}
+	}
+	return events
+}
+
+// matches tells whether the event e for the path is within any watched path.
+func (f *fanotify) matches(path string, e Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fw, ok := f.m[path]; ok && fw.e&e != 0 {
+		return true
+	}
+	for dir, base := filepath.Dir(path), true; ; dir, base = filepath.Dir(dir), false {
+		if fw, ok := f.m[dir]; ok && (base || fw.isrec) && fw.e&e != 0 {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+// openByHandle resolves the path of the directory identified by the handle
+// within the filesystem of mountfd.
+func openByHandle(mountfd int, handle []byte) (string, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_OPEN_BY_HANDLE_AT, uintptr(mountfd),
+		uintptr(unsafe.Pointer(&handle[0])), unix.O_PATH|unix.O_CLOEXEC)
+	if errno != 0 {
+		return "", os.NewSyscallError("open_by_handle_at", errno)
+	}
+	defer unix.Close(int(fd))
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(fd)))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(path, " (deleted)") {
+		return "", os.ErrNotExist
+	}
+	return path, nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build !linux || !(amd64 || arm64)
+// +build !linux !amd64,!arm64
+
+package notify
+
+import "errors"
+
+// newFanotify fails, fanotify is not supported on the platform.
+func newFanotify(chan<- EventInfo) (watcher, error) {
+	return nil, errors.New("notify: fanotify is not supported")
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifierFanotify(t *testing.T) {
+	w, err := newFanotify(make(chan EventInfo))
+	if err != nil {
+		t.Skipf("fanotify is not available: %v", err)
+	}
+	w.Close()
+	tmpDir := t.TempDir()
+	mustT(t, os.Mkdir(filepath.Join(tmpDir, "other"), 0755))
+	mustT(t, os.Mkdir(filepath.Join(tmpDir, "src"), 0755))
+	tmpDir, err = canonical(tmpDir)
+	mustT(t, err)
+
+	n := NewNotifier(WithBackend(Fanotify), WithOrdered(1))
+	defer n.Close()
+	c := make(chan EventInfo, 16)
+	mustT(t, n.Watch(filepath.Join(tmpDir, "src", "..."), c, Create, Remove))
+	if b := n.Backend(); b != Fanotify {
+		t.Fatalf("want backend=%v; got %v", Fanotify, b)
+	}
+
+	expect := func(e Event, path string) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != e || ei.Path() != path {
+				t.Fatalf("want %v on %s; got %v", e, path, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for %v on %s", e, path)
+		}
+	}
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "other", "file"), nil, 0644))
+	dir := filepath.Join(tmpDir, "src", "a", "b")
+	mustT(t, os.MkdirAll(dir, 0755))
+	file := filepath.Join(dir, "file")
+	mustT(t, os.WriteFile(file, []byte("x"), 0644))
+	expect(Create, filepath.Join(tmpDir, "src", "a"))
+	expect(Create, dir)
+	expect(Create, file)
+	mustT(t, os.Remove(file))
+	expect(Remove, file)
+
+	n.Stop(c)
+	mustT(t, os.WriteFile(file, nil, 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event after Stop: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -13,6 +13,9 @@ import (
 	"syscall"
 )
 
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = FEN
+
 // newTrigger returns implementation of trigger.
 func newTrigger(pthLkp map[string]*watched) trigger {
 	return &fen{
@@ -79,7 +82,7 @@ func (f *fen) Watched(n interface{}) (*watched, int64, error) {
 	}
 	w, ok := f.pthLkp[fo.Name]
 	if !ok {
-		return nil, 0, errNotWatched
+		return nil, 0, ErrNotWatched
 	}
 	return w, int64(pe.PortevEvents), nil
 }
@@ -82,7 +82,7 @@ func (c *cfen) portAssociate(p int, fo FileObj, e int) (err error) {
 func (c *cfen) portDissociate(port int, fo FileObj) (err error) {
 	cfo, ok := c.p2fo[fo.Name]
 	if !ok {
-		return errNotWatched
+		return ErrNotWatched
 	}
 	_, err = C.port_dissociate(C.int(port), srcFile, C.conv(cfo))
 	C.free(unsafe.Pointer(cfo.fo_name))
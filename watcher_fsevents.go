@@ -52,6 +52,7 @@ type watch struct {
 	events  uint32
 	isrec   int32
 	flushed bool
+	reads   *atomic.Uint64 // number of events read by the watcher
 }
 
 // Example format:
@@ -110,7 +111,7 @@ func (w *watch) strip(base string, set uint32) uint32 {
 			set &^= write
 		}
 	}
-	dbgprintf("split()=%v\n", Event(set))
+	debug("split", "event", Event(set))
 	return set
 }
 
@@ -127,8 +128,9 @@ func (w *watch) Dispatch(ev []FSEvent) {
 		if !w.flushed {
 			continue
 		}
-		dbgprintf("%v (0x%x) (%s, i=%d, ID=%d, len=%d)\n", Event(ev[i].Flags),
-			ev[i].Flags, ev[i].Path, i, ev[i].ID, len(ev))
+		w.reads.Add(1)
+		debug("received", "event", Event(ev[i].Flags), "flags", ev[i].Flags,
+			"path", ev[i].Path, "i", i, "id", ev[i].ID, "len", len(ev))
 		if ev[i].Flags&failure != 0 && failure&events == 0 {
 			// TODO(rjeczalik): missing error handling
 			continue
@@ -153,7 +155,7 @@ func (w *watch) Dispatch(ev []FSEvent) {
 			continue
 		}
 		for _, e := range splitflags(e) {
-			dbgprintf("%d: single event: %v", ev[i].ID, Event(e))
+			debug("single event", "id", ev[i].ID, "event", Event(e))
 			w.c <- &event{
 				fse:   ev[i],
 				event: Event(e),
@@ -177,8 +179,12 @@ func (w *watch) Stop() {
 type fsevents struct {
 	watches map[string]*watch
 	c       chan<- EventInfo
+	reads   atomic.Uint64 // number of events read from FSEvents
 }
 
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = FSEvents
+
 func newWatcher(c chan<- EventInfo) watcher {
 	return &fsevents{
 		watches: make(map[string]*watch),
@@ -188,7 +194,7 @@ func newWatcher(c chan<- EventInfo) watcher {
 
 func (fse *fsevents) watch(path string, event Event, isrec int32) (err error) {
 	if _, ok := fse.watches[path]; ok {
-		return errAlreadyWatched
+		return ErrAlreadyWatched
 	}
 	w := &watch{
 		prev:   make(map[string]uint32),
@@ -196,6 +202,7 @@ func (fse *fsevents) watch(path string, event Event, isrec int32) (err error) {
 		path:   path,
 		events: uint32(event),
 		isrec:  isrec,
+		reads:  &fse.reads,
 	}
 	w.stream = newStream(path, w.Dispatch)
 	if err = w.stream.Start(); err != nil {
@@ -208,50 +215,66 @@ func (fse *fsevents) watch(path string, event Event, isrec int32) (err error) {
 func (fse *fsevents) unwatch(path string) (err error) {
 	w, ok := fse.watches[path]
 	if !ok {
-		return errNotWatched
+		return ErrNotWatched
 	}
 	w.stream.Stop()
 	delete(fse.watches, path)
 	return nil
 }
 
+// Watches implements notify.statWatcher interface.
+func (fse *fsevents) Watches() int {
+	return len(fse.watches)
+}
+
+// Read implements notify.statWatcher interface.
+func (fse *fsevents) Read() uint64 {
+	return fse.reads.Load()
+}
+
+// Watched implements notify.statWatcher interface.
+func (fse *fsevents) Watched(path string) bool {
+	_, ok := fse.watches[path]
+	return ok
+}
+
 // Watch implements Watcher interface. It fails with non-nil error when setting
-// the watch-point by FSEvents fails or with errAlreadyWatched error when
+// the watch-point by FSEvents fails or with ErrAlreadyWatched error when
 // the given path is already watched.
 func (fse *fsevents) Watch(path string, event Event) error {
 	return fse.watch(path, event, 0)
 }
 
-// Unwatch implements Watcher interface. It fails with errNotWatched when
+// Unwatch implements Watcher interface. It fails with ErrNotWatched when
 // the given path is not being watched.
 func (fse *fsevents) Unwatch(path string) error {
 	return fse.unwatch(path)
 }
 
-// Rewatch implements Watcher interface. It fails with errNotWatched when
-// the given path is not being watched or with errInvalidEventSet when oldevent
+// Rewatch implements Watcher interface. It fails with ErrNotWatched when
+// the given path is not being watched or with ErrInvalidEventSet when oldevent
 // does not match event set the watch-point currently holds.
 func (fse *fsevents) Rewatch(path string, oldevent, newevent Event) error {
 	w, ok := fse.watches[path]
 	if !ok {
-		return errNotWatched
+		return ErrNotWatched
 	}
 	if !atomic.CompareAndSwapUint32(&w.events, uint32(oldevent), uint32(newevent)) {
-		return errInvalidEventSet
+		return ErrInvalidEventSet
 	}
 	atomic.StoreInt32(&w.isrec, 0)
 	return nil
 }
 
 // RecursiveWatch implements RecursiveWatcher interface. It fails with non-nil
-// error when setting the watch-point by FSEvents fails or with errAlreadyWatched
+// error when setting the watch-point by FSEvents fails or with ErrAlreadyWatched
 // error when the given path is already watched.
 func (fse *fsevents) RecursiveWatch(path string, event Event) error {
 	return fse.watch(path, event, 1)
 }
 
 // RecursiveUnwatch implements RecursiveWatcher interface. It fails with
-// errNotWatched when the given path is not being watched.
+// ErrNotWatched when the given path is not being watched.
 //
 // TODO(rjeczalik): fail if w.isrec == 0?
 func (fse *fsevents) RecursiveUnwatch(path string) error {
@@ -260,9 +283,9 @@ func (fse *fsevents) RecursiveUnwatch(path string) error {
 
 // RecursiveRewatch implements RecursiveWatcher interface. It fails:
 //
-//   - with errNotWatched when the given path is not being watched
-//   - with errInvalidEventSet when oldevent does not match the current event set
-//   - with errAlreadyWatched when watch-point given by the oldpath was meant to
+//   - with ErrNotWatched when the given path is not being watched
+//   - with ErrInvalidEventSet when oldevent does not match the current event set
+//   - with ErrAlreadyWatched when watch-point given by the oldpath was meant to
 //     be relocated to newpath, but the newpath is already watched
 //   - a non-nil error when setting the watch-point with FSEvents fails
 //
@@ -273,14 +296,14 @@ func (fse *fsevents) RecursiveRewatch(oldpath, newpath string, oldevent, neweven
 	case [2]bool{true, true}:
 		w, ok := fse.watches[oldpath]
 		if !ok {
-			return errNotWatched
+			return ErrNotWatched
 		}
 		atomic.StoreInt32(&w.isrec, 1)
 		return nil
 	case [2]bool{true, false}:
 		w, ok := fse.watches[oldpath]
 		if !ok {
-			return errNotWatched
+			return ErrNotWatched
 		}
 		if !atomic.CompareAndSwapUint32(&w.events, uint32(oldevent), uint32(newevent)) {
 			return errors.New("invalid event state diff")
@@ -291,7 +314,7 @@ func (fse *fsevents) RecursiveRewatch(oldpath, newpath string, oldevent, neweven
 		// TODO(rjeczalik): rewatch newpath only if exists?
 		// TODO(rjeczalik): migrate w.prev to new watch?
 		if _, ok := fse.watches[newpath]; ok {
-			return errAlreadyWatched
+			return ErrAlreadyWatched
 		}
 		if err := fse.Unwatch(oldpath); err != nil {
 			return err
@@ -10,10 +10,14 @@ package notify
 import (
 	"bytes"
 	"errors"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -31,17 +35,37 @@ const consumersCount = 2
 
 const invalidDescriptor = -1
 
+// recmask are inotify events every directory of a recursive watch listens on,
+// in order to follow changes of the directory structure.
+const recmask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM
+
 // watched is a pair of file path and inotify mask used as a value in
-// watched files map.
+// watched files map. Directories of recursive watches hold also the path of
+// the watch they belong to. Values are never modified once stored in the map.
 type watched struct {
 	path string
 	mask uint32
+	rec  string // path of the recursive watch, empty for non-recursive ones
+}
+
+// inmask gives the mask the directory is watched with. Roots of watches are
+// watched also for being moved, which invalidates them.
+func (w *watched) inmask() uint32 {
+	switch {
+	case w.rec == "":
+		return encode(Event(w.mask)) | unix.IN_MOVE_SELF
+	case w.rec == w.path:
+		return encode(Event(w.mask)) | recmask | unix.IN_MOVE_SELF
+	}
+	return encode(Event(w.mask)) | recmask
 }
 
 // inotify implements Watcher interface.
 type inotify struct {
-	sync.RWMutex                       // protects inotify.m map
+	sync.RWMutex                       // protects inotify.m, inotify.paths and inotify.removed maps
 	m            map[int32]*watched    // watch descriptor to watched object
+	paths        map[string]int32      // path of watched object to watch descriptor
+	removed      map[int32]struct{}    // descriptors removed by the watcher, whose IN_IGNORED was not read yet
 	fd           int32                 // inotify file descriptor
 	pipefd       []int                 // pipe's read and write descriptors
 	epfd         int                   // epoll descriptor
@@ -49,17 +73,32 @@ type inotify struct {
 	buffer       [eventBufferSize]byte // inotify event buffer
 	wg           sync.WaitGroup        // wait group used to close main loop
 	c            chan<- EventInfo      // event dispatcher channel
+	report       func(error)           // asynchronous errors handler
+	excluded     func(string) bool     // reports directories not to be watched
+	rescan       bool                  // whether to rescan recursive watches on overflow
+	window       time.Duration         // pairing window for Move events
+	consumers    int                   // number of consumer goroutines
+	reads        atomic.Uint64         // number of events read from inotify
 }
 
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = Inotify
+
 // NewWatcher creates new non-recursive inotify backed by inotify.
 func newWatcher(c chan<- EventInfo) watcher {
 	i := &inotify{
-		m:      make(map[int32]*watched),
-		fd:     invalidDescriptor,
-		pipefd: []int{invalidDescriptor, invalidDescriptor},
-		epfd:   invalidDescriptor,
-		epes:   make([]unix.EpollEvent, 0),
-		c:      c,
+		m:         make(map[int32]*watched),
+		paths:     make(map[string]int32),
+		removed:   make(map[int32]struct{}),
+		fd:        invalidDescriptor,
+		pipefd:    []int{invalidDescriptor, invalidDescriptor},
+		epfd:      invalidDescriptor,
+		epes:      make([]unix.EpollEvent, 0),
+		c:         c,
+		report:    func(error) {},
+		excluded:  func(string) bool { return false },
+		window:    moveWindow,
+		consumers: consumersCount,
 	}
 	runtime.SetFinalizer(i, func(i *inotify) {
 		i.epollclose()
@@ -70,13 +109,63 @@ func newWatcher(c chan<- EventInfo) watcher {
 	return i
 }
 
+// SetErrorHandler implements notify.errorWatcher interface.
+func (i *inotify) SetErrorHandler(fn func(error)) {
+	i.report = fn
+}
+
+// SetExcluded implements notify.excludeWatcher interface.
+func (i *inotify) SetExcluded(fn func(string) bool) {
+	i.excluded = fn
+}
+
+// SetRescan implements notify.rescanWatcher interface.
+func (i *inotify) SetRescan() {
+	i.rescan = true
+}
+
+// Watches implements notify.statWatcher interface.
+func (i *inotify) Watches() int {
+	i.RLock()
+	defer i.RUnlock()
+	return len(i.m)
+}
+
+// Read implements notify.statWatcher interface.
+func (i *inotify) Read() uint64 {
+	return i.reads.Load()
+}
+
+// Watched implements notify.statWatcher interface.
+func (i *inotify) Watched(path string) bool {
+	i.RLock()
+	defer i.RUnlock()
+	_, ok := i.paths[path]
+	return ok
+}
+
+// SetOrdered implements notify.orderedWatcher interface. It makes inotify
+// use a single consumer, so events are sent in the order they were read.
+func (i *inotify) SetOrdered() {
+	i.consumers = 1
+}
+
+// SetMoveWindow implements notify.moveWatcher interface.
+func (i *inotify) SetMoveWindow(d time.Duration) {
+	i.window = d
+}
+
 // Watch implements notify.watcher interface.
 func (i *inotify) Watch(path string, e Event) error {
 	return i.watch(path, e)
 }
 
-// Rewatch implements notify.watcher interface.
+// Rewatch implements notify.watcher interface. It makes the watch of the path
+// non-recursive.
 func (i *inotify) Rewatch(path string, _, newevent Event) error {
+	i.Lock()
+	i.drop(func(w *watched) bool { return w.rec == path && w.path != path })
+	i.Unlock()
 	return i.watch(path, newevent)
 }
 
@@ -84,32 +173,226 @@ func (i *inotify) Rewatch(path string, _, newevent Event) error {
 // one. If called for the first time, this function initializes inotify filesystem
 // monitor and starts producer-consumers goroutines.
 func (i *inotify) watch(path string, e Event) (err error) {
-	if e&^(All|Event(unix.IN_ALL_EVENTS)) != 0 {
-		return errors.New("notify: unknown event")
+	if e&^(All|Move|Event(unix.IN_ALL_EVENTS)) != 0 {
+		return ErrUnknownEvent
 	}
 	if err = i.lazyinit(); err != nil {
 		return
 	}
-	iwd, err := unix.InotifyAddWatch(int(i.fd), path, encode(e))
+	i.Lock()
+	defer i.Unlock()
+	_, err = i.add(&watched{path: path, mask: uint32(e)})
+	return err
+}
+
+// add watches the directory described by w, replacing its previous watch if
+// any, and gives the watch descriptor. It expects i to be locked.
+func (i *inotify) add(w *watched) (int32, error) {
+	iwd, err := unix.InotifyAddWatch(int(i.fd), w.path, w.inmask())
 	if err != nil {
-		return
+		return invalidDescriptor, limitError(err)
+	}
+	i.set(int32(iwd), w)
+	debug("inotify: watched", "path", w.path, "event", Event(w.mask), "wd", iwd)
+	return int32(iwd), nil
+}
+
+// set stores w as the watched object of the watch descriptor iwd. It expects
+// i to be locked.
+func (i *inotify) set(iwd int32, w *watched) {
+	if old, ok := i.m[iwd]; ok && i.paths[old.path] == iwd {
+		delete(i.paths, old.path)
+	}
+	i.m[iwd] = w
+	i.paths[w.path] = iwd
+}
+
+// del forgets the watch descriptor iwd. A removed path may have been watched
+// again with a new descriptor, before the old one was forgotten. It expects i
+// to be locked.
+func (i *inotify) del(iwd int32) {
+	if w, ok := i.m[iwd]; ok && i.paths[w.path] == iwd {
+		delete(i.paths, w.path)
+	}
+	delete(i.m, iwd)
+}
+
+// RecursiveWatch implements notify.recursiveWatcher interface. It watches every
+// directory within the path, except for the excluded ones. If the watch limit
+// was reached, the directories watched so far stay watched and the error is
+// *WatchLimitError.
+func (i *inotify) RecursiveWatch(path string, e Event) error {
+	if e&^(All|Move|Event(unix.IN_ALL_EVENTS)) != 0 {
+		return ErrUnknownEvent
+	}
+	if err := i.lazyinit(); err != nil {
+		return err
 	}
 	i.Lock()
-	if wd, ok := i.m[int32(iwd)]; !ok {
-		i.m[int32(iwd)] = &watched{path: path, mask: uint32(e)}
-	} else {
-		wd.path = path
-		wd.mask = uint32(e)
+	defer i.Unlock()
+	w := &watched{path: path, mask: uint32(e), rec: path}
+	iwd, err := i.add(w)
+	if err != nil {
+		var lerr *WatchLimitError
+		if errors.As(err, &lerr) {
+			lerr.Needed = i.count(path)
+		}
+		return err
 	}
+	_, err = i.addtree(w, iwd, false)
+	return err
+}
+
+// RecursiveRewatch implements notify.recursiveWatcher interface. The newpath
+// is always either equal to the oldpath or its parent, therefore the watch is
+// set on the newpath first, taking over the directories of the old one.
+func (i *inotify) RecursiveRewatch(oldpath, newpath string, _, e Event) error {
+	err := i.RecursiveWatch(newpath, e)
+	var lerr *WatchLimitError
+	if oldpath == newpath || err != nil && !errors.As(err, &lerr) {
+		return err
+	}
+	i.Lock()
+	i.drop(func(w *watched) bool { return w.rec == oldpath || w.rec == "" && w.path == oldpath })
 	i.Unlock()
-	return nil
+	return err
+}
+
+// RecursiveUnwatch implements notify.recursiveWatcher interface.
+func (i *inotify) RecursiveUnwatch(path string) error {
+	return i.Unwatch(path)
+}
+
+// addtree watches directories within the directory w, which belongs to
+// a recursive watch and is watched with the descriptor iwd. If emit is true,
+// Create events are given for everything found within the directory, since
+// it may have been created before the watches were added. Once the watch limit
+// is reached, the rest of the tree is walked and *WatchLimitError is returned,
+// telling the number of all the directories the watch needs, w included. It
+// expects i to be locked.
+func (i *inotify) addtree(w *watched, iwd int32, emit bool) (es []*event, err error) {
+	var lerr *WatchLimitError
+	added := 1 // w itself
+	filepath.WalkDir(w.path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || path == w.path {
+			// Unreadable directories are watched without their content.
+			return nil
+		}
+		if emit {
+			mask := uint32(unix.IN_CREATE)
+			if de.IsDir() {
+				mask |= unix.IN_ISDIR
+			}
+			es = append(es, &event{
+				sys:  unix.InotifyEvent{Wd: iwd, Mask: mask},
+				path: path[len(w.path)+1:],
+				wd:   w,
+			})
+		}
+		switch {
+		case !de.IsDir():
+			return nil
+		case i.excluded(path):
+			// The directory may have been watched before it got excluded.
+			i.drop(func(it *watched) bool {
+				return it.rec == w.rec && (it.path == path || indexrel(path, it.path) != -1)
+			})
+			return filepath.SkipDir
+		case lerr != nil:
+			lerr.Needed++
+			return nil
+		}
+		if _, err := i.add(&watched{path: path, mask: w.mask, rec: w.rec}); err != nil {
+			if errors.As(err, &lerr) {
+				lerr.Needed = added + 1
+				return nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				i.report(&WatchError{Op: "watch", Path: path, Err: err})
+			}
+			return filepath.SkipDir
+		}
+		added++
+		return nil
+	})
+	if lerr != nil {
+		return es, lerr
+	}
+	return es, nil
+}
+
+// count gives the number of directories within the directory path, the path
+// included, which a recursive watch of the path needs.
+func (i *inotify) count(path string) (n int) {
+	filepath.WalkDir(path, func(dir string, de fs.DirEntry, err error) error {
+		switch {
+		case err != nil || !de.IsDir():
+			return nil
+		case dir != path && i.excluded(dir):
+			return filepath.SkipDir
+		}
+		n++
+		return nil
+	})
+	return n
+}
+
+// drop removes the watches, for which fn reports true, and gives their number.
+// It expects i to be locked.
+func (i *inotify) drop(fn func(*watched) bool) (n int, err error) {
+	for iwd, w := range i.m {
+		if !fn(w) {
+			continue
+		}
+		if e := i.rmwatch(iwd); e != nil && err == nil {
+			err = e
+		}
+		i.del(iwd)
+		debug("inotify: unwatched", "path", w.path, "wd", iwd)
+		n++
+	}
+	return n, err
+}
+
+// limitError gives *WatchLimitError for the given error of inotify_add_watch,
+// if the limit of watches was reached.
+func limitError(err error) error {
+	serr := os.NewSyscallError("inotify_add_watch", err)
+	if err != unix.ENOSPC {
+		return serr
+	}
+	max := -1
+	if p, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches"); err == nil {
+		if n, err := strconv.Atoi(string(bytes.TrimSpace(p))); err == nil {
+			max = n
+		}
+	}
+	return &WatchLimitError{Max: max, Held: heldWatches(), Needed: 1, Err: serr}
 }
 
-// lazyinit sets up all required file descriptors and starts 1+consumersCount
+// heldWatches gives the number of inotify watches held by the process, counted
+// across all its inotify instances, or -1 if it cannot be told.
+func heldWatches() int {
+	const fdinfo = "/proc/self/fdinfo"
+	fds, err := os.ReadDir(fdinfo)
+	if err != nil {
+		return -1
+	}
+	n := 0
+	for _, fd := range fds {
+		if p, err := os.ReadFile(filepath.Join(fdinfo, fd.Name())); err == nil {
+			n += bytes.Count(p, []byte("inotify wd:"))
+		}
+	}
+	return n
+}
+
+// lazyinit sets up all required file descriptors and starts 2+i.consumers
 // goroutines. The producer goroutine blocks until file-system notifications
 // occur. Then, all events are read from system buffer and sent to consumer
-// goroutines which construct valid notify events. This method uses
-// Double-Checked Locking optimization.
+// goroutines which construct valid notify events. Rename events are paired
+// by a separate goroutine. This method uses Double-Checked Locking
+// optimization.
 func (i *inotify) lazyinit() error {
 	if atomic.LoadInt32(&i.fd) == invalidDescriptor {
 		i.Lock()
@@ -117,7 +400,7 @@ func (i *inotify) lazyinit() error {
 		if atomic.LoadInt32(&i.fd) == invalidDescriptor {
 			fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
 			if err != nil {
-				return err
+				return os.NewSyscallError("inotify_init1", err)
 			}
 			i.fd = int32(fd)
 			if err = i.epollinit(); err != nil {
@@ -125,12 +408,22 @@ func (i *inotify) lazyinit() error {
 				i.fd = invalidDescriptor
 				return err
 			}
-			esch := make(chan []*event)
+			esch, mvch := make(chan []*event), make(chan *event)
 			go i.loop(esch)
-			i.wg.Add(consumersCount)
-			for n := 0; n < consumersCount; n++ {
-				go i.send(esch)
+			var consumers sync.WaitGroup
+			consumers.Add(i.consumers)
+			i.wg.Add(i.consumers + 1)
+			for n := 0; n < i.consumers; n++ {
+				go func() {
+					i.send(esch, mvch)
+					consumers.Done()
+				}()
 			}
+			go func() {
+				consumers.Wait()
+				close(mvch)
+			}()
+			go i.pair(mvch)
 		}
 	}
 	return nil
@@ -142,19 +435,22 @@ func (i *inotify) lazyinit() error {
 // Note that `fd` member must be set before this function is called.
 func (i *inotify) epollinit() (err error) {
 	if i.epfd, err = unix.EpollCreate1(0); err != nil {
-		return
+		return os.NewSyscallError("epoll_create1", err)
 	}
 	if err = unix.Pipe(i.pipefd); err != nil {
-		return
+		return os.NewSyscallError("pipe", err)
 	}
 	i.epes = []unix.EpollEvent{
 		{Events: unix.EPOLLIN, Fd: i.fd},
 		{Events: unix.EPOLLIN, Fd: int32(i.pipefd[0])},
 	}
 	if err = unix.EpollCtl(i.epfd, unix.EPOLL_CTL_ADD, int(i.fd), &i.epes[0]); err != nil {
-		return
+		return os.NewSyscallError("epoll_ctl", err)
+	}
+	if err = unix.EpollCtl(i.epfd, unix.EPOLL_CTL_ADD, i.pipefd[0], &i.epes[1]); err != nil {
+		return os.NewSyscallError("epoll_ctl", err)
 	}
-	return unix.EpollCtl(i.epfd, unix.EPOLL_CTL_ADD, i.pipefd[0], &i.epes[1])
+	return nil
 }
 
 // epollclose closes the file descriptor created by the call to epoll_create(2)
@@ -182,6 +478,9 @@ func (i *inotify) epollclose() (err error) {
 // All read operations triggered by filesystem notifications are forwarded to
 // one of the event's consumers. If pipe fd became ready, loop function closes
 // all file descriptors opened by lazyinit method and returns afterwards.
+//
+// If epoll_wait(2) fails unexpectedly, loop reports the error and restarts
+// the watcher. If the restart fails, all watches are lost and loop returns.
 func (i *inotify) loop(esch chan<- []*event) {
 	epes := make([]unix.EpollEvent, 1)
 	fd := atomic.LoadInt32(&i.fd)
@@ -190,27 +489,68 @@ func (i *inotify) loop(esch chan<- []*event) {
 		case nil:
 			switch epes[0].Fd {
 			case fd:
-				esch <- i.read()
+				esch <- i.follow(i.read())
 				epes[0].Fd = 0
 			case int32(i.pipefd[0]):
 				i.Lock()
 				defer i.Unlock()
 				if err = unix.Close(int(fd)); err != nil && err != unix.EINTR {
-					panic("notify: close(2) error " + err.Error())
+					i.report(&WatchError{Op: "close", Err: os.NewSyscallError("close", err)})
 				}
 				atomic.StoreInt32(&i.fd, invalidDescriptor)
 				if err = i.epollclose(); err != nil && err != unix.EINTR {
-					panic("notify: epollclose error " + err.Error())
+					i.report(&WatchError{Op: "close", Err: os.NewSyscallError("close", err)})
 				}
 				close(esch)
 				return
 			}
 		case unix.EINTR:
 			continue
-		default: // We should never reach this line.
-			panic("notify: epoll_wait(2) error " + err.Error())
+		default:
+			i.report(&WatchError{Op: "epoll_wait", Err: os.NewSyscallError("epoll_wait", err)})
+			if err = i.restart(); err != nil {
+				i.report(&WatchError{Op: "restart", Err: err})
+				close(esch)
+				return
+			}
+			fd = atomic.LoadInt32(&i.fd)
+			epes[0].Fd = 0
+		}
+	}
+}
+
+// restart closes all file descriptors and opens them again, restoring every
+// watch that was previously set. Watches which could not be restored are
+// reported and dropped. If restart fails, the watcher is left closed with no
+// watches set - the next call to Watch initializes it from scratch. It must
+// be called from the loop goroutine only.
+func (i *inotify) restart() (err error) {
+	i.Lock()
+	defer i.Unlock()
+	_, _ = i.epollclose(), unix.Close(int(i.fd)) // Ignore errors.
+	atomic.StoreInt32(&i.fd, invalidDescriptor)
+	m := i.m
+	i.m, i.paths = make(map[int32]*watched), make(map[string]int32)
+	i.removed = make(map[int32]struct{})
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	i.fd = int32(fd)
+	if err = i.epollinit(); err != nil {
+		_, _ = i.epollclose(), unix.Close(fd) // Ignore errors.
+		atomic.StoreInt32(&i.fd, invalidDescriptor)
+		return err
+	}
+	for _, wd := range m {
+		iwd, err := unix.InotifyAddWatch(fd, wd.path, wd.inmask())
+		if err != nil {
+			i.report(&WatchError{Op: "watch", Path: wd.path, Err: os.NewSyscallError("inotify_add_watch", err)})
+			continue
 		}
+		i.set(int32(iwd), wd)
 	}
+	return nil
 }
 
 // read reads events from an inotify file descriptor. It does not handle errors
@@ -239,16 +579,158 @@ func (i *inotify) read() (es []*event) {
 			path: path,
 		})
 	}
+	i.reads.Add(uint64(len(es)))
 	return
 }
 
+// follow resolves watches of the events read from inotify and follows changes
+// of the directory structure of recursive watches. New directories are watched
+// right away, before any other event is read, and everything which may have
+// been created within them meanwhile is reported with Create events following
+// the one of the directory. Directories moved out of recursive watches are
+// unwatched, until they are moved in again, while watches of removed paths
+// are forgotten. Overflow triggers a rescan, if enabled. It must be called
+// from the loop goroutine only.
+func (i *inotify) follow(es []*event) []*event {
+	i.Lock()
+	defer i.Unlock()
+	out := make([]*event, 0, len(es))
+	for _, e := range es {
+		if e.sys.Mask&unix.IN_IGNORED != 0 {
+			if _, ok := i.removed[e.sys.Wd]; ok {
+				// The watch was removed by the watcher, not by inotify, its
+				// path is not gone.
+				delete(i.removed, e.sys.Wd)
+				continue
+			}
+		}
+		out = append(out, e)
+		if e.sys.Mask&unix.IN_Q_OVERFLOW != 0 {
+			if i.rescan {
+				out = append(out, i.rescanrec()...)
+			}
+			continue
+		}
+		w, ok := i.m[e.sys.Wd]
+		if !ok {
+			continue
+		}
+		e.wd = w
+		switch mask := e.sys.Mask; {
+		case mask&unix.IN_IGNORED != 0:
+			// The path is gone, so is its watch.
+			i.del(e.sys.Wd)
+		case w.rec == "":
+		case mask&unix.IN_ISDIR == 0 || e.path == "":
+		case mask&unix.IN_MOVED_FROM != 0:
+			dir := filepath.Join(w.path, e.path)
+			for iwd, it := range i.m {
+				if it.rec == w.rec && (it.path == dir || indexrel(dir, it.path) != -1) {
+					// Watchpoints within the directory are no longer valid.
+					out = append(out, &event{
+						sys: unix.InotifyEvent{Wd: iwd, Mask: unix.IN_IGNORED},
+						wd:  it,
+					})
+				}
+			}
+			i.drop(func(it *watched) bool {
+				return it.rec == w.rec && (it.path == dir || indexrel(dir, it.path) != -1)
+			})
+		case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			out = append(out, i.grow(w, filepath.Join(w.path, e.path), mask&unix.IN_CREATE != 0)...)
+		}
+	}
+	return out
+}
+
+// grow watches the new directory dir within the recursive watch of w, together
+// with its subdirectories. If emit is true, it gives Create events for their
+// content. It expects i to be locked.
+func (i *inotify) grow(w *watched, dir string, emit bool) []*event {
+	if i.excluded(dir) {
+		return nil
+	}
+	nw := &watched{path: dir, mask: w.mask, rec: w.rec}
+	iwd, err := i.add(nw)
+	if err != nil {
+		var lerr *WatchLimitError
+		if errors.As(err, &lerr) {
+			lerr.Needed = i.count(dir)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			i.report(&WatchError{Op: "watch", Path: dir, Err: err})
+		}
+		return nil
+	}
+	es, err := i.addtree(nw, iwd, emit)
+	if err != nil {
+		i.report(&WatchError{Op: "watch", Path: dir, Err: err})
+	}
+	return es
+}
+
+// rescanrec reconciles recursive watches with the filesystem after an overflow.
+// Directories, which no longer exist, are unwatched and reported with Remove
+// events, while new directories are watched and reported, with their content,
+// with Create events. It expects i to be locked.
+func (i *inotify) rescanrec() (es []*event) {
+	type root struct {
+		w   *watched
+		iwd int32
+	}
+	var roots []root
+	dirs := make(map[string]bool)
+	for iwd, w := range i.m {
+		switch {
+		case w.rec == "":
+			continue
+		case w.path == w.rec:
+			roots = append(roots, root{w: w, iwd: iwd})
+		default:
+			if _, err := os.Lstat(w.path); os.IsNotExist(err) {
+				es = append(es, &event{
+					sys: unix.InotifyEvent{Wd: iwd, Mask: unix.IN_DELETE_SELF | unix.IN_ISDIR},
+					wd:  w,
+				})
+				i.rmwatch(iwd)
+				i.del(iwd)
+				continue
+			}
+		}
+		dirs[w.path] = true
+	}
+	for _, r := range roots {
+		filepath.WalkDir(r.w.path, func(path string, de fs.DirEntry, err error) error {
+			switch {
+			case err != nil || !de.IsDir() || dirs[path]:
+				return nil
+			case i.excluded(path):
+				return filepath.SkipDir
+			}
+			es = append(es, &event{
+				sys:  unix.InotifyEvent{Wd: r.iwd, Mask: unix.IN_CREATE | unix.IN_ISDIR},
+				path: path[len(r.w.path)+1:],
+				wd:   r.w,
+			})
+			es = append(es, i.grow(r.w, path, true)...)
+			return filepath.SkipDir
+		})
+	}
+	return es
+}
+
 // send is a consumer function which sends events to event dispatcher channel.
 // It is run in a separate goroutine in order to not block loop method when
-// possibly expensive write operations are performed on inotify map.
-func (i *inotify) send(esch <-chan []*event) {
+// possibly expensive write operations are performed on inotify map. Rename
+// events which are to be paired are sent to mvch instead.
+func (i *inotify) send(esch <-chan []*event, mvch chan<- *event) {
 	for es := range esch {
 		for _, e := range i.transform(es) {
-			if e != nil {
+			switch {
+			case e == nil:
+			case e.event == Move:
+				mvch <- e
+			default:
 				i.c <- e
 			}
 		}
@@ -256,20 +738,121 @@ func (i *inotify) send(esch <-chan []*event) {
 	i.wg.Done()
 }
 
+// pair pairs rename events received from mvch by their cookies and sends Move
+// events to event dispatcher channel. Rename events, for which no pair was
+// found within the pairing window, are sent as Remove or Create events.
+// Pending events are discarded when mvch gets closed.
+func (i *inotify) pair(mvch <-chan *event) {
+	defer i.wg.Done()
+	type half struct {
+		e        *event
+		deadline time.Time
+	}
+	var (
+		pending = make(map[uint32]half)
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+	for {
+		select {
+		case e, ok := <-mvch:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+			h, ok := pending[e.sys.Cookie]
+			switch {
+			case !ok:
+				pending[e.sys.Cookie] = half{e: e, deadline: time.Now().Add(i.window)}
+			case (h.e.sys.Mask^e.sys.Mask)&unix.IN_MOVED_FROM == 0:
+				// Both are the same end of a move, which should not happen.
+				i.c <- unpaired(h.e)
+				pending[e.sys.Cookie] = half{e: e, deadline: time.Now().Add(i.window)}
+			default:
+				delete(pending, e.sys.Cookie)
+				i.c <- paired(h.e, e)
+			}
+		case now := <-timeout:
+			for cookie, h := range pending {
+				if !h.deadline.After(now) {
+					delete(pending, cookie)
+					i.c <- unpaired(h.e)
+				}
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		var next time.Time
+		for _, h := range pending {
+			if next.IsZero() || h.deadline.Before(next) {
+				next = h.deadline
+			}
+		}
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+	}
+}
+
+// paired creates a Move event out of two rename events of a single move.
+func paired(e1, e2 *event) *moved {
+	from, to := e1, e2
+	if from.sys.Mask&unix.IN_MOVED_FROM == 0 {
+		from, to = to, from
+	}
+	return &moved{
+		e:   Move,
+		p:   to.path,
+		old: from.path,
+		d:   to.sys.Mask&unix.IN_ISDIR != 0,
+		sys: &to.sys,
+	}
+}
+
+// unpaired creates a Remove or Create event out of a single rename event of
+// a move, for which the other end was not observed.
+func unpaired(e *event) *moved {
+	ev := Create
+	if e.sys.Mask&unix.IN_MOVED_FROM != 0 {
+		ev = Remove
+	}
+	return &moved{
+		e:   ev,
+		p:   e.path,
+		d:   e.sys.Mask&unix.IN_ISDIR != 0,
+		sys: &e.sys,
+	}
+}
+
 // transform prepares events read from inotify file descriptor for sending to
 // user. It removes invalid events and these which are no longer present in
 // inotify map. This method may also split one raw event into two different ones
 // when system-dependent result is required.
 func (i *inotify) transform(es []*event) []*event {
 	var multi []*event
-	i.RLock()
 	for idx, e := range es {
-		if e.sys.Mask&(unix.IN_IGNORED|unix.IN_Q_OVERFLOW) != 0 {
-			es[idx] = nil
+		if e.sys.Mask&unix.IN_Q_OVERFLOW != 0 {
+			// Overflow is not related to any watch descriptor, the tree
+			// forwards it to every watchpoint.
+			e.event = Overflow
+			continue
+		}
+		wd := e.wd
+		switch {
+		case wd == nil:
+		case e.sys.Mask&unix.IN_IGNORED != 0:
+			// The tree removes the watchpoints of the path.
+			e.event, e.path = invalidated, wd.path
 			continue
+		case e.sys.Mask&unix.IN_MOVE_SELF != 0 && (wd.rec == "" || wd.rec == wd.path):
+			multi = append(multi, &event{sys: e.sys, path: wd.path, event: invalidated})
 		}
-		wd, ok := i.m[e.sys.Wd]
-		if !ok || e.sys.Mask&encode(Event(wd.mask)) == 0 {
+		if wd == nil || e.sys.Mask&encode(Event(wd.mask)) == 0 {
 			es[idx] = nil
 			continue
 		}
@@ -278,12 +861,14 @@ func (i *inotify) transform(es []*event) []*event {
 		} else {
 			e.path = filepath.Join(wd.path, e.path)
 		}
+		if Event(wd.mask)&Move != 0 && e.sys.Mask&uint32(InMovedFrom|InMovedTo) != 0 {
+			multi = append(multi, &event{sys: e.sys, path: e.path, event: Move})
+		}
 		multi = append(multi, decode(Event(wd.mask), e))
 		if e.event == 0 {
 			es[idx] = nil
 		}
 	}
-	i.RUnlock()
 	es = append(es, multi...)
 	return es
 }
@@ -303,6 +888,9 @@ func encode(e Event) uint32 {
 	if e&Rename != 0 {
 		e = (e ^ Rename) | InMovedFrom | InMoveSelf
 	}
+	if e&Move != 0 {
+		e = (e ^ Move) | InMovedFrom | InMovedTo
+	}
 	return uint32(e)
 }
 
@@ -335,31 +923,19 @@ func decode(mask Event, e *event) (syse *event) {
 	return
 }
 
-// Unwatch implements notify.watcher interface. It looks for watch descriptor
-// related to registered path and if found, calls inotify_rm_watch(2) function.
-// This method is allowed to return EINVAL error when concurrently requested to
-// delete identical path.
+// Unwatch implements notify.watcher interface. It looks for watch descriptors
+// related to registered path, or every directory of the recursive watch of the
+// path, and calls inotify_rm_watch(2) function for them.
 func (i *inotify) Unwatch(path string) (err error) {
-	iwd := int32(invalidDescriptor)
-	i.RLock()
-	for iwdkey, wd := range i.m {
-		if wd.path == path {
-			iwd = iwdkey
-			break
-		}
-	}
-	i.RUnlock()
-	if iwd == invalidDescriptor {
-		return errors.New("notify: path " + path + " is already watched")
-	}
-	fd := atomic.LoadInt32(&i.fd)
-	if err = removeInotifyWatch(fd, iwd); err != nil {
-		return
-	}
 	i.Lock()
-	delete(i.m, iwd)
-	i.Unlock()
-	return nil
+	defer i.Unlock()
+	n, err := i.drop(func(w *watched) bool {
+		return w.rec == path || w.rec == "" && w.path == path
+	})
+	if n == 0 {
+		return ErrNotWatched
+	}
+	return err
 }
 
 // Close implements notify.watcher interface. It removes all existing watch
@@ -373,10 +949,10 @@ func (i *inotify) Close() (err error) {
 		return nil
 	}
 	for iwd := range i.m {
-		if e := removeInotifyWatch(i.fd, iwd); e != nil && err == nil {
+		if e := i.rmwatch(iwd); e != nil && err == nil {
 			err = e
 		}
-		delete(i.m, iwd)
+		i.del(iwd)
 	}
 	switch _, errwrite := unix.Write(i.pipefd[1], []byte{0x00}); {
 	case errwrite != nil && err == nil:
@@ -391,10 +967,17 @@ func (i *inotify) Close() (err error) {
 	return
 }
 
-// if path was removed, notify already removed the watch and returns EINVAL error
-func removeInotifyWatch(fd int32, iwd int32) (err error) {
-	if _, err = unix.InotifyRmWatch(int(fd), uint32(iwd)); err != nil && err != unix.EINVAL {
-		return
+// rmwatch removes the watch descriptor iwd. IN_IGNORED, which inotify sends
+// for the removed descriptor, is skipped, so it does not invalidate the path.
+// It expects i to be locked.
+func (i *inotify) rmwatch(iwd int32) error {
+	if _, err := unix.InotifyRmWatch(int(i.fd), uint32(iwd)); err != nil {
+		if err == unix.EINVAL {
+			// If path was removed, inotify already removed the watch.
+			return nil
+		}
+		return os.NewSyscallError("inotify_rm_watch", err)
 	}
+	i.removed[iwd] = struct{}{}
 	return nil
 }
@@ -11,6 +11,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func icreate(w *W, path string) WCase {
@@ -131,3 +134,139 @@ func TestWatcherInotify(t *testing.T) {
 
 	w.ExpectAny(cases[:])
 }
+
+func TestInotifyTransformOverflow(t *testing.T) {
+	i := newWatcher(nil).(*inotify)
+
+	es := i.transform([]*event{
+		{sys: unix.InotifyEvent{Wd: -1, Mask: unix.IN_Q_OVERFLOW}},
+		{sys: unix.InotifyEvent{Wd: 1, Mask: unix.IN_IGNORED}},
+	})
+
+	var got []Event
+	for _, e := range es {
+		if e != nil {
+			got = append(got, e.Event())
+		}
+	}
+	if len(got) != 1 || got[0] != Overflow {
+		t.Fatalf("want [%v]; got %v", Overflow, got)
+	}
+}
+
+func TestInotifyPairMove(t *testing.T) {
+	c := make(chan EventInfo, 4)
+	i := newWatcher(c).(*inotify)
+	i.SetMoveWindow(10 * time.Millisecond)
+	mvch := make(chan *event)
+	i.wg.Add(1)
+	go i.pair(mvch)
+
+	half := func(mask, cookie uint32, path string) *event {
+		return &event{sys: unix.InotifyEvent{Mask: mask, Cookie: cookie}, path: path, event: Move}
+	}
+	mvch <- half(unix.IN_MOVED_FROM, 1, "/a/old")
+	mvch <- half(unix.IN_MOVED_TO, 2, "/b/in")
+	mvch <- half(unix.IN_MOVED_TO, 1, "/b/new")
+	mvch <- half(unix.IN_MOVED_FROM|unix.IN_ISDIR, 3, "/a/out")
+
+	want := map[string]*moved{
+		"/b/new": {e: Move, p: "/b/new", old: "/a/old"},
+		"/b/in":  {e: Create, p: "/b/in"},
+		"/a/out": {e: Remove, p: "/a/out", d: true},
+	}
+	for range want {
+		select {
+		case ei := <-c:
+			mi, ok := ei.(*moved)
+			if !ok {
+				t.Fatalf("want *moved; got %T", ei)
+			}
+			w, ok := want[mi.Path()]
+			if !ok {
+				t.Fatalf("unexpected event: %v", ei)
+			}
+			if mi.e != w.e || mi.old != w.old || mi.d != w.d {
+				t.Fatalf("want %v (dir=%t); got %v (dir=%t)", w, w.d, mi, mi.d)
+			}
+		case <-time.After(timeout()):
+			t.Fatal("timed out waiting for move events")
+		}
+	}
+	close(mvch)
+	i.wg.Wait()
+}
+
+func TestInotifyCount(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"a/b", "a/c", "skip/d"} {
+		mustT(t, os.MkdirAll(filepath.Join(tmpDir, dir), 0755))
+	}
+	mustT(t, os.WriteFile(filepath.Join(tmpDir, "a", "file"), nil, 0644))
+
+	i := newWatcher(nil).(*inotify)
+	i.SetExcluded(func(dir string) bool { return filepath.Base(dir) == "skip" })
+	// The directory itself, a, a/b and a/c.
+	if n := i.count(tmpDir); n != 4 {
+		t.Fatalf("want 4 directories; got %d", n)
+	}
+}
+
+func TestInotifyIgnored(t *testing.T) {
+	tmpDir := t.TempDir()
+	a, b := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")
+	mustT(t, os.Mkdir(a, 0755))
+	mustT(t, os.Mkdir(b, 0755))
+
+	i := newWatcher(nil).(*inotify)
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	mustT(t, err)
+	i.fd = int32(fd)
+	defer func() {
+		unix.Close(fd)
+		i.fd = invalidDescriptor
+	}()
+	invalidated := func() (paths []string) {
+		t.Helper()
+		done := make(chan []*event)
+		go func() { done <- i.transform(i.follow(i.read())) }()
+		select {
+		case es := <-done:
+			for _, e := range es {
+				if e != nil && e.event == invalidated {
+					paths = append(paths, e.path)
+				}
+			}
+		case <-time.After(timeout()):
+			t.Fatal("timed out before reading events")
+		}
+		return paths
+	}
+
+	// IN_IGNORED of a removed watch does not invalidate the path, even if its
+	// descriptor was given to another watch meanwhile.
+	i.Lock()
+	iwd, err := i.add(&watched{path: a, mask: uint32(Create)})
+	mustT(t, err)
+	_, err = i.drop(func(*watched) bool { return true })
+	mustT(t, err)
+	i.set(iwd, &watched{path: b, mask: uint32(Create)})
+	i.Unlock()
+	if paths := invalidated(); len(paths) != 0 {
+		t.Fatalf("want no path to be invalidated; got %v", paths)
+	}
+
+	// IN_IGNORED of a removed path invalidates it.
+	i.Lock()
+	_, err = i.add(&watched{path: a, mask: uint32(Create)})
+	i.Unlock()
+	mustT(t, err)
+	mustT(t, os.Remove(a))
+	var paths []string
+	for len(paths) == 0 {
+		paths = invalidated()
+	}
+	if len(paths) != 1 || paths[0] != a {
+		t.Fatalf("want [%s] to be invalidated; got %v", a, paths)
+	}
+}
@@ -14,6 +14,9 @@ import (
 	"syscall"
 )
 
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = Kqueue
+
 // newTrigger returns implementation of trigger.
 func newTrigger(pthLkp map[string]*watched) trigger {
 	return &kq{
@@ -70,7 +73,7 @@ func (*kq) NewWatched(p string, fi os.FileInfo) (*watched, error) {
 		if errors.Is(err, syscall.ENOTSUP) && fi.Mode()&os.ModeSocket == os.ModeSocket {
 			return nil, errSkip
 		}
-		return nil, err
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
 	}
 	return &watched{
 		trgWatched: trgWatched{p: p, fi: fi},
@@ -101,17 +104,17 @@ func inter2kq(n interface{}) syscall.Kevent_t {
 // Init implements trigger.
 func (k *kq) Init() (err error) {
 	if k.fd, err = syscall.Kqueue(); err != nil {
-		return
+		return os.NewSyscallError("kqueue", err)
 	}
 	// Creates pipe used to stop `Kevent` call by registering it,
 	// watching read end and writing to other end of it.
 	if err = syscall.Pipe(k.pipefds[:]); err != nil {
-		return nonil(err, k.Close())
+		return nonil(os.NewSyscallError("pipe", err), k.Close())
 	}
 	var kevn [1]syscall.Kevent_t
 	syscall.SetKevent(&kevn[0], k.pipefds[0], syscall.EVFILT_READ, syscall.EV_ADD)
 	if _, err = syscall.Kevent(k.fd, kevn[:], nil, nil); err != nil {
-		return nonil(err, k.Close())
+		return nonil(os.NewSyscallError("kevent", err), k.Close())
 	}
 	return
 }
@@ -122,7 +125,7 @@ func (k *kq) Unwatch(w *watched) (err error) {
 	syscall.SetKevent(&kevn[0], w.fd, syscall.EVFILT_VNODE, syscall.EV_DELETE)
 
 	_, err = syscall.Kevent(k.fd, kevn[:], nil, nil)
-	return
+	return os.NewSyscallError("kevent", err)
 }
 
 // Watch implements trigger.
@@ -133,7 +136,7 @@ func (k *kq) Watch(fi os.FileInfo, w *watched, e int64) (err error) {
 	kevn[0].Fflags = uint32(e)
 
 	_, err = syscall.Kevent(k.fd, kevn[:], nil, nil)
-	return
+	return os.NewSyscallError("kevent", err)
 }
 
 // Wait implements trigger.
@@ -155,7 +158,7 @@ func (k *kq) Watched(n interface{}) (*watched, int64, error) {
 		panic(fmt.Sprintf("kq: type should be syscall.Kevent_t, %T instead", kevn))
 	}
 	if _, ok = k.idLkp[int(kevn.Ident)]; !ok {
-		return nil, 0, errNotWatched
+		return nil, 0, ErrNotWatched
 	}
 	return k.idLkp[int(kevn.Ident)], int64(kevn.Fflags), nil
 }
@@ -7,9 +7,10 @@
 
 package notify
 
-import "errors"
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = Polling
 
-// newWatcher stub.
-func newWatcher(chan<- EventInfo) watcher {
-	return watcherStub{errors.New("notify: not implemented")}
+// newWatcher gives the polling watcher, the platform has no native one.
+func newWatcher(c chan<- EventInfo) watcher {
+	return newPoller(c, 0)
 }
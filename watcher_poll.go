@@ -0,0 +1,422 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pollInterval is the default interval of scanning polled paths.
+const pollInterval = time.Second
+
+// fileID identifies a file within a system, zero value means unknown.
+type fileID struct {
+	dev, ino uint64
+}
+
+// pollstat is the state of a file, which is compared between scans.
+type pollstat struct {
+	id    fileID
+	mode  fs.FileMode
+	size  int64
+	mtime time.Time
+}
+
+func statOf(fi fs.FileInfo) pollstat {
+	return pollstat{id: fileid(fi), mode: fi.Mode(), size: fi.Size(), mtime: fi.ModTime()}
+}
+
+// polled is a path watched by poller.
+type polled struct {
+	e     Event
+	isrec bool
+	state map[string]pollstat // path relative to the polled one, "" for itself
+}
+
+// poller implements watcher and recursiveWatcher interfaces by scanning watched
+// paths periodically and comparing their state with the one of the previous
+// scan. It works on every filesystem, including network and FUSE ones, which
+// do not support native notifications.
+//
+// Files are compared by their mode, size and modification time, which yields
+// Create, Remove and Write events. Renames are detected by inode numbers and
+// reported with Rename and Create events, or Move events if requested. On
+// platforms, which do not expose inode numbers, renames are reported with
+// Remove and Create events.
+//
+// Changes, which happen between two scans and cancel each other out, are not
+// reported.
+type poller struct {
+	mu       sync.Mutex         // protects m
+	m        map[string]*polled // watched paths
+	c        chan<- EventInfo   // event dispatcher channel
+	interval time.Duration      // interval of scans
+	once     sync.Once          // starts the scanning goroutine
+	stop     sync.Once          // closes done
+	done     chan struct{}      // closed by Close
+	wg       sync.WaitGroup     // waits for the scanning goroutine
+	reads    atomic.Uint64      // number of events found by scans
+}
+
+// newPoller creates a poller, which scans watched paths with the given interval.
+// Non-positive interval means the default one.
+func newPoller(c chan<- EventInfo, interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = pollInterval
+	}
+	return &poller{
+		m:        make(map[string]*polled),
+		c:        c,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// scan reads the state of the path. The state of a directory contains all of
+// its entries, or all files within it, if isrec is true. Symlinks are not
+// followed.
+func scan(path string, isrec bool) (map[string]pollstat, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]pollstat{"": statOf(fi)}
+	if !fi.IsDir() {
+		return state, nil
+	}
+	if !isrec {
+		des, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, de := range des {
+			if fi, err := de.Info(); err == nil {
+				state[de.Name()] = statOf(fi)
+			}
+		}
+		return state, nil
+	}
+	err = filepath.WalkDir(path, func(p string, de fs.DirEntry, err error) error {
+		if err != nil || p == path {
+			// Unreadable directories are kept without their content.
+			return nil
+		}
+		if fi, err := de.Info(); err == nil {
+			state[p[len(path)+1:]] = statOf(fi)
+		}
+		return nil
+	})
+	return state, err
+}
+
+// Watch implements notify.watcher interface.
+func (p *poller) Watch(path string, e Event) error {
+	return p.watch(path, e, false)
+}
+
+// RecursiveWatch implements notify.recursiveWatcher interface.
+func (p *poller) RecursiveWatch(path string, e Event) error {
+	return p.watch(path, e, true)
+}
+
+func (p *poller) watch(path string, e Event, isrec bool) error {
+	state, err := scan(path, isrec)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.m[path]; ok {
+		return ErrAlreadyWatched
+	}
+	p.m[path] = &polled{e: e, isrec: isrec, state: state}
+	p.once.Do(func() {
+		p.wg.Add(1)
+		go p.loop()
+	})
+	debug("poller: watched", "path", path, "event", e, "recursive", isrec)
+	return nil
+}
+
+// Rewatch implements notify.watcher interface. It makes the watch of the path
+// non-recursive.
+func (p *poller) Rewatch(path string, _, e Event) error {
+	return p.rewatch(path, e, false)
+}
+
+// RecursiveRewatch implements notify.recursiveWatcher interface. It makes the
+// watch of the newpath recursive.
+func (p *poller) RecursiveRewatch(oldpath, newpath string, _, e Event) error {
+	if oldpath == newpath {
+		return p.rewatch(newpath, e, true)
+	}
+	p.mu.Lock()
+	_, ok := p.m[newpath]
+	p.mu.Unlock()
+	if ok {
+		return ErrAlreadyWatched
+	}
+	if err := p.Unwatch(oldpath); err != nil {
+		return err
+	}
+	return p.watch(newpath, e, true)
+}
+
+// rewatch sets the event set of the watch of the path, rescanning it if its
+// recursiveness changes.
+func (p *poller) rewatch(path string, e Event, isrec bool) error {
+	p.mu.Lock()
+	pd, ok := p.m[path]
+	if ok {
+		pd.e = e
+		ok = pd.isrec != isrec
+	} else {
+		p.mu.Unlock()
+		return ErrNotWatched
+	}
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	state, err := scan(path, isrec)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pd, ok := p.m[path]; ok {
+		pd.isrec, pd.state = isrec, state
+	}
+	return nil
+}
+
+// Unwatch implements notify.watcher interface.
+func (p *poller) Unwatch(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.m[path]; !ok {
+		return ErrNotWatched
+	}
+	delete(p.m, path)
+	debug("poller: unwatched", "path", path)
+	return nil
+}
+
+// RecursiveUnwatch implements notify.recursiveWatcher interface.
+func (p *poller) RecursiveUnwatch(path string) error {
+	return p.Unwatch(path)
+}
+
+// SetMoveWindow implements notify.moveWatcher interface. Renames are detected
+// within a single scan, the window is not used.
+func (p *poller) SetMoveWindow(time.Duration) {}
+
+// Close implements notify.watcher interface. When it returns, the poller sends
+// no more events.
+func (p *poller) Close() error {
+	p.once.Do(func() {}) // the scanning goroutine must not start afterwards
+	p.stop.Do(func() { close(p.done) })
+	p.wg.Wait()
+	return nil
+}
+
+// Watches implements notify.statWatcher interface.
+func (p *poller) Watches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.m)
+}
+
+// Read implements notify.statWatcher interface.
+func (p *poller) Read() uint64 {
+	return p.reads.Load()
+}
+
+// Watched implements notify.statWatcher interface.
+func (p *poller) Watched(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.m[path]
+	return ok
+}
+
+// loop scans watched paths every interval, until the poller is closed.
+func (p *poller) loop() {
+	defer p.wg.Done()
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			if !p.scan() {
+				return
+			}
+		}
+	}
+}
+
+// scan scans all watched paths once and sends the events for the changes. It
+// reports false if the poller was closed meanwhile.
+func (p *poller) scan() bool {
+	type item struct {
+		path  string
+		isrec bool
+	}
+	p.mu.Lock()
+	items := make([]item, 0, len(p.m))
+	for path, pd := range p.m {
+		items = append(items, item{path: path, isrec: pd.isrec})
+	}
+	p.mu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].path < items[j].path })
+	for _, it := range items {
+		state, err := scan(it.path, it.isrec)
+		if err != nil && !os.IsNotExist(err) {
+			debug("poller: scan failed", "path", it.path, "err", err)
+			continue
+		}
+		p.mu.Lock()
+		pd, ok := p.m[it.path]
+		if !ok || pd.isrec != it.isrec {
+			// Changed during the scan.
+			p.mu.Unlock()
+			continue
+		}
+		events := diffstate(it.path, pd.e, pd.state, state)
+		pd.state = state
+		p.mu.Unlock()
+		p.reads.Add(uint64(len(events)))
+		for _, ei := range events {
+			select {
+			case p.c <- ei:
+			case <-p.done:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// diffstate gives the events, which describe the change of the path from the
+// old to the new state, limited to the event set e. Nil new state means the
+// path does not exist anymore.
+func diffstate(path string, e Event, old, new map[string]pollstat) (events []EventInfo) {
+	name := func(rel string) string {
+		if rel == "" {
+			return path
+		}
+		return filepath.Join(path, rel)
+	}
+	var removed, created, written []string
+	for rel, o := range old {
+		switch n, ok := new[rel]; {
+		case !ok:
+			removed = append(removed, rel)
+		case o.mode.Type() != n.mode.Type() || (o.id != n.id && o.id != fileID{}):
+			// Replaced with another file.
+			removed = append(removed, rel)
+			created = append(created, rel)
+		case n.mode.IsRegular() && (o.size != n.size || !o.mtime.Equal(n.mtime)):
+			written = append(written, rel)
+		}
+	}
+	for rel := range new {
+		if _, ok := old[rel]; !ok {
+			created = append(created, rel)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(created)
+	sort.Strings(written)
+	// Pair removed and created files by their IDs into renames. Files within
+	// a renamed directory are renamed along with it.
+	ids := make(map[fileID]string)
+	for _, rel := range removed {
+		if id := old[rel].id; id != (fileID{}) {
+			ids[id] = rel
+		}
+	}
+	renamed := make(map[string]string) // new to old path
+	dirs := make(map[string]string)    // new to old path of renamed directories
+	within := func(rel string, m map[string]string) (string, bool) {
+		for dir := filepath.Dir(rel); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			if o, ok := m[dir]; ok {
+				return filepath.Join(o, rel[len(dir)+1:]), true
+			}
+		}
+		return "", false
+	}
+	for _, rel := range created {
+		o, ok := ids[new[rel].id]
+		if !ok || o == rel {
+			continue
+		}
+		renamed[rel] = o
+		if new[rel].mode.IsDir() {
+			dirs[rel] = o
+		}
+	}
+	existed := func(state map[string]pollstat, rel string) bool {
+		_, ok := state[rel]
+		return ok
+	}
+	gone := make(map[string]bool) // old paths, which are reported as renamed
+	for n, o := range renamed {
+		if oo, ok := within(n, dirs); ok && oo == o {
+			// Renamed along with its directory.
+			delete(renamed, n)
+			gone[o] = true
+			continue
+		}
+		gone[o] = true
+	}
+	for _, rel := range removed {
+		if _, ok := renamed[rel]; ok {
+			// Replaced by a rename, e.g. during an atomic save.
+			continue
+		}
+		if !gone[rel] && e&Remove != 0 {
+			events = append(events, &synthetic{e: Remove, p: name(rel), d: old[rel].mode.IsDir()})
+		}
+	}
+	for _, rel := range created {
+		d := new[rel].mode.IsDir()
+		o, ok := renamed[rel]
+		switch {
+		case ok:
+			if e&Rename != 0 {
+				events = append(events, &synthetic{e: Rename, p: name(o), d: d})
+			}
+			if e&Move != 0 {
+				events = append(events, &moved{e: Move, p: name(rel), old: name(o), d: d})
+			}
+			if e&Create != 0 {
+				events = append(events, &synthetic{e: Create, p: name(rel), d: d})
+			}
+		case e&Create != 0:
+			if o, ok := within(rel, dirs); !ok || !existed(old, o) {
+				events = append(events, &synthetic{e: Create, p: name(rel), d: d})
+			}
+		}
+	}
+	if e&Write != 0 {
+		for _, rel := range written {
+			events = append(events, &synthetic{e: Write, p: name(rel)})
+		}
+	}
+	if _, ok := new[""]; !ok && existed(old, "") {
+		// The polled path itself is gone.
+		events = append(events, &synthetic{e: Invalidated, p: path, d: old[""].mode.IsDir()})
+	}
+	return events
+}
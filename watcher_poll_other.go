@@ -0,0 +1,15 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build !unix
+// +build !unix
+
+package notify
+
+import "io/fs"
+
+// fileid gives zero fileID, the platform does not expose inode numbers.
+func fileid(fs.FileInfo) fileID {
+	return fileID{}
+}
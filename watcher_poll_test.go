@@ -0,0 +1,105 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffstate(t *testing.T) {
+	var (
+		dir  = pollstat{mode: os.ModeDir | 0755}
+		file = func(ino uint64, size int64) pollstat {
+			return pollstat{id: fileID{dev: 1, ino: ino}, mode: 0644, size: size}
+		}
+		e = Create | Remove | Write | Rename | Move
+	)
+	cases := []struct {
+		old, new map[string]pollstat
+		want     []string
+	}{{
+		map[string]pollstat{"": dir, "a": file(1, 0)},
+		map[string]pollstat{"": dir, "a": file(1, 3)},
+		[]string{"notify.Write a"},
+	}, {
+		map[string]pollstat{"": dir, "a": file(1, 0)},
+		map[string]pollstat{"": dir, "b": file(2, 0)},
+		[]string{"notify.Remove a", "notify.Create b"},
+	}, {
+		map[string]pollstat{"": dir, "a": file(1, 0)},
+		map[string]pollstat{"": dir, "b": file(1, 0)},
+		[]string{"notify.Rename a", "notify.Move b", "notify.Create b"},
+	}, {
+		// Files are renamed along with their directory.
+		map[string]pollstat{"": dir, "d": {id: fileID{1, 1}, mode: os.ModeDir}, "d/f": file(2, 0)},
+		map[string]pollstat{"": dir, "e": {id: fileID{1, 1}, mode: os.ModeDir}, "e/f": file(2, 0), "e/g": file(3, 0)},
+		[]string{"notify.Rename d", "notify.Move e", "notify.Create e", "notify.Create e/g"},
+	}, {
+		// Atomic save replaces the file with a temporary one.
+		map[string]pollstat{"": dir, "f": file(1, 0), "f.tmp": file(2, 3)},
+		map[string]pollstat{"": dir, "f": file(2, 3)},
+		[]string{"notify.Rename f.tmp", "notify.Move f", "notify.Create f"},
+	}, {
+		map[string]pollstat{"": dir, "a": file(1, 0)},
+		nil,
+		[]string{"notify.Remove ", "notify.Remove a", "notify.Invalidated "},
+	}}
+	for i, cas := range cases {
+		var got []string
+		for _, ei := range diffstate("", e, cas.old, cas.new) {
+			got = append(got, ei.Event().String()+" "+filepath.ToSlash(ei.Path()))
+		}
+		if !reflect.DeepEqual(got, cas.want) {
+			t.Errorf("want events=%v; got %v (i=%d)", cas.want, got, i)
+		}
+	}
+}
+
+func TestPoller(t *testing.T) {
+	dir := t.TempDir()
+	mustT(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	dir, err := canonical(dir)
+	mustT(t, err)
+
+	c := make(chan EventInfo, 16)
+	p := newPoller(c, 10*time.Millisecond)
+	defer p.Close()
+	mustT(t, p.RecursiveWatch(dir, Create|Write))
+
+	file := filepath.Join(dir, "sub", "file")
+	expect := func(e Event) {
+		t.Helper()
+		select {
+		case ei := <-c:
+			if ei.Event() != e || ei.Path() != file {
+				t.Fatalf("want %v on %s; got %v", e, file, ei)
+			}
+		case <-time.After(timeout()):
+			t.Fatalf("timed out waiting for %v", e)
+		}
+	}
+	mustT(t, os.WriteFile(file, nil, 0644))
+	expect(Create)
+	mustT(t, os.WriteFile(file, []byte("x"), 0644))
+	expect(Write)
+
+	mustT(t, p.Rewatch(dir, Create|Write, Create|Write))
+	mustT(t, os.WriteFile(file, []byte("xx"), 0644))
+	select {
+	case ei := <-c:
+		t.Fatalf("received unexpected event after non-recursive rewatch: %v", ei)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := p.Unwatch(dir); err != nil {
+		t.Fatalf("Unwatch()=%v", err)
+	}
+	if err := p.Unwatch(dir); err != ErrNotWatched {
+		t.Fatalf("want err=%v; got %v", ErrNotWatched, err)
+	}
+}
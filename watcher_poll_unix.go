@@ -0,0 +1,21 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+//go:build unix
+// +build unix
+
+package notify
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileid gives the device and inode numbers of the file.
+func fileid(fi fs.FileInfo) fileID {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return fileID{}
+}
@@ -9,6 +9,7 @@ package notify
 
 import (
 	"errors"
+	"os"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -98,11 +99,11 @@ func (g *grip) register(cph syscall.Handle) (err error) {
 		syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OVERLAPPED,
 		0,
 	); err != nil {
-		return
+		return os.NewSyscallError("CreateFile", err)
 	}
 	if _, err = syscall.CreateIoCompletionPort(g.handle, cph, 0, 0); err != nil {
 		syscall.CloseHandle(g.handle)
-		return
+		return os.NewSyscallError("CreateIoCompletionPort", err)
 	}
 	return g.readDirChanges()
 }
@@ -116,7 +117,7 @@ func (g *grip) readDirChanges() error {
 		return nil // Handle was closed.
 	}
 
-	return syscall.ReadDirectoryChanges(
+	err := syscall.ReadDirectoryChanges(
 		handle,
 		&g.buffer[0],
 		uint32(unsafe.Sizeof(g.buffer)),
@@ -126,6 +127,7 @@ func (g *grip) readDirChanges() error {
 		(*syscall.Overlapped)(unsafe.Pointer(g.ovlapped)),
 		0,
 	)
+	return os.NewSyscallError("ReadDirectoryChanges", err)
 }
 
 // encode transforms a generic filter, which contains platform independent and
@@ -264,8 +266,32 @@ type readdcw struct {
 	start bool
 	wg    sync.WaitGroup
 	c     chan<- EventInfo
+	reads atomic.Uint64 // number of events read from the OS
+}
+
+// Watches implements notify.statWatcher interface.
+func (r *readdcw) Watches() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.m)
+}
+
+// Read implements notify.statWatcher interface.
+func (r *readdcw) Read() uint64 {
+	return r.reads.Load()
 }
 
+// Watched implements notify.statWatcher interface.
+func (r *readdcw) Watched(path string) bool {
+	r.Lock()
+	defer r.Unlock()
+	_, ok := r.m[path]
+	return ok
+}
+
+// nativeBackend is the backend of newWatcher.
+const nativeBackend = ReadDirectoryChangesW
+
 // NewWatcher creates new non-recursive watcher backed by ReadDirectoryChangesW.
 func newWatcher(c chan<- EventInfo) watcher {
 	r := &readdcw{
@@ -296,14 +322,14 @@ func (r *readdcw) RecursiveWatch(path string, event Event) error {
 // watch starts the main event loop goroutine when called for the first time.
 func (r *readdcw) watch(path string, event Event, recursive bool) error {
 	if event&^(All|fileNotifyChangeAll) != 0 {
-		return errors.New("notify: unknown event")
+		return ErrUnknownEvent
 	}
 
 	r.Lock()
 	defer r.Unlock()
 
 	if wd, ok := r.m[path]; ok {
-		dbgprint("watch: already exists")
+		debug("watch: already exists", "path", path)
 		wd.filter &^= stateUnwatch
 		return nil
 	}
@@ -318,7 +344,7 @@ func (r *readdcw) watch(path string, event Event, recursive bool) error {
 	}
 
 	r.m[path] = wd
-	dbgprint("watch: new watch added")
+	debug("watch: new watch added", "path", path)
 
 	return nil
 }
@@ -330,7 +356,7 @@ func (r *readdcw) lazyinit() (err error) {
 	if atomic.LoadUintptr((*uintptr)(&r.cph)) == invalid {
 		cph := syscall.InvalidHandle
 		if cph, err = syscall.CreateIoCompletionPort(cph, 0, 0, 0); err != nil {
-			return
+			return os.NewSyscallError("CreateIoCompletionPort", err)
 		}
 
 		r.cph, r.start = cph, true
@@ -361,7 +387,7 @@ func (r *readdcw) loop() {
 		}
 		overEx := (*overlappedEx)(unsafe.Pointer(overlapped))
 		if overEx == nil || overEx.parent == nil {
-			dbgprintf("incomplete completion status transferred=%d, overlapped=%#v, key=%#b", n, overEx, key)
+			debug("incomplete completion status", "transferred", n, "overlapped", overEx, "key", key)
 			continue
 		} else if n != 0 {
 			r.loopevent(n, overEx)
@@ -384,10 +410,10 @@ func (r *readdcw) loopstate(overEx *overlappedEx) {
 	if overEx.parent.parent.count--; overEx.parent.parent.count == 0 {
 		switch filter & onlyMachineStates {
 		case stateRewatch:
-			dbgprint("loopstate rewatch")
+			debug("loopstate rewatch")
 			overEx.parent.parent.recreate(r.cph)
 		case stateUnwatch:
-			dbgprint("loopstate unwatch")
+			debug("loopstate unwatch")
 			overEx.parent.parent.closeHandle()
 			delete(r.m, syscall.UTF16ToString(overEx.parent.pathw))
 		case stateCPClose:
@@ -417,6 +443,7 @@ func (r *readdcw) loopevent(n uint32, overEx *overlappedEx) {
 			break
 		}
 	}
+	r.reads.Add(uint64(len(events)))
 	r.send(events)
 }
 
@@ -472,7 +499,7 @@ func (r *readdcw) RecursiveRewatch(oldpath, newpath string, oldevent,
 // TODO : (pknap) doc.
 func (r *readdcw) rewatch(path string, oldevent, newevent uint32, recursive bool) (err error) {
 	if Event(newevent)&^(All|fileNotifyChangeAll) != 0 {
-		return errors.New("notify: unknown event")
+		return ErrUnknownEvent
 	}
 	var wd *watched
 	r.Lock()
@@ -497,7 +524,7 @@ func (r *readdcw) rewatch(path string, oldevent, newevent uint32, recursive bool
 func (r *readdcw) nonStateWatchedLocked(path string) (wd *watched, err error) {
 	wd, ok := r.m[path]
 	if !ok || wd == nil {
-		err = errors.New(`notify: ` + path + ` path is unwatched`)
+		err = ErrNotWatched
 		return
 	}
 	if wd.filter&onlyMachineStates != 0 {
@@ -528,7 +555,7 @@ func (r *readdcw) unwatch(path string) (err error) {
 	}
 
 	wd.filter |= stateUnwatch
-	dbgprint("unwatch: set unwatch state")
+	debug("unwatch: set unwatch state", "path", path)
 
 	if _, attrErr := syscall.GetFileAttributes(&wd.pathw[0]); attrErr != nil {
 		for _, g := range wd.digrip {
@@ -536,7 +563,7 @@ func (r *readdcw) unwatch(path string) (err error) {
 				continue
 			}
 
-			dbgprint("unwatch: posting")
+			debug("unwatch: posting", "path", path)
 			if err = syscall.PostQueuedCompletionStatus(r.cph, 0, 0, (*syscall.Overlapped)(unsafe.Pointer(g.ovlapped))); err != nil {
 				wd.filter &^= stateUnwatch
 				return
@@ -589,7 +616,7 @@ func decode(filter, action uint32) (Event, Event) {
 	case syscall.FILE_ACTION_RENAMED_NEW_NAME:
 		return gensys(filter, Rename, FileActionRenamedNewName)
 	}
-	dbgprintf("cannot decode internal mask: %d", action)
+	debug("cannot decode internal mask", "action", action)
 
 	return 0, 0
 }
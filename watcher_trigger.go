@@ -29,6 +29,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
@@ -96,6 +97,30 @@ type trg struct {
 	pthLkp map[string]*watched
 	// t is a platform dependent implementation of trigger.
 	t trigger
+	// report is a handler for asynchronous errors.
+	report func(error)
+	// reads is the number of events returned by native calls.
+	reads atomic.Uint64
+}
+
+// Watches implements notify.statWatcher interface.
+func (t *trg) Watches() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.pthLkp)
+}
+
+// Read implements notify.statWatcher interface.
+func (t *trg) Read() uint64 {
+	return t.reads.Load()
+}
+
+// Watched implements notify.statWatcher interface.
+func (t *trg) Watched(path string) bool {
+	t.Lock()
+	defer t.Unlock()
+	_, ok := t.pthLkp[path]
+	return ok
 }
 
 // newWatcher returns new watcher's implementation.
@@ -104,6 +129,7 @@ func newWatcher(c chan<- EventInfo) watcher {
 		s:      make(chan struct{}, 1),
 		pthLkp: make(map[string]*watched, 0),
 		c:      c,
+		report: func(error) {},
 	}
 	t.t = newTrigger(t.pthLkp)
 	if err := t.t.Init(); err != nil {
@@ -114,6 +140,11 @@ func newWatcher(c chan<- EventInfo) watcher {
 	return t
 }
 
+// SetErrorHandler implements errorWatcher.
+func (t *trg) SetErrorHandler(fn func(error)) {
+	t.report = fn
+}
+
 // Close implements watcher.
 func (t *trg) Close() (err error) {
 	t.Lock()
@@ -125,12 +156,12 @@ func (t *trg) Close() (err error) {
 	var e error
 	for _, w := range t.pthLkp {
 		if e = t.unwatch(w.p, w.fi); e != nil {
-			dbgprintf("trg: unwatch %q failed: %q\n", w.p, e)
+			debug("trg: unwatch failed", "path", w.p, "err", e)
 			err = nonil(err, e)
 		}
 	}
 	if e = t.t.Close(); e != nil {
-		dbgprintf("trg: closing native watch failed: %q\n", e)
+		debug("trg: closing native watch failed", "err", e)
 		err = nonil(err, e)
 	}
 	if remaining := len(t.pthLkp); remaining != 0 {
@@ -174,7 +205,7 @@ func (t *trg) singlewatch(p string, e Event, direct mode, fi os.FileInfo) (err e
 		t.t.Record(w)
 		return nil
 	}
-	return errAlreadyWatched
+	return ErrAlreadyWatched
 }
 
 // decode converts event received from native to notify.Event
@@ -196,7 +227,7 @@ func decode(o int64, w Event) (e Event) {
 
 func (t *trg) watch(p string, e Event, fi os.FileInfo) error {
 	if err := t.singlewatch(p, e, dir, fi); err != nil {
-		if err != errAlreadyWatched {
+		if err != ErrAlreadyWatched {
 			return err
 		}
 	}
@@ -204,7 +235,7 @@ func (t *trg) watch(p string, e Event, fi os.FileInfo) error {
 		err := t.walk(p, func(fi os.FileInfo) (err error) {
 			if err = t.singlewatch(filepath.Join(p, fi.Name()), e, ndir,
 				fi); err != nil {
-				if err != errAlreadyWatched {
+				if err != ErrAlreadyWatched {
 					return
 				}
 			}
@@ -240,7 +271,7 @@ func (t *trg) unwatch(p string, fi os.FileInfo) error {
 	if fi.IsDir() {
 		err := t.walk(p, func(fi os.FileInfo) error {
 			err := t.singleunwatch(filepath.Join(p, fi.Name()), ndir)
-			if err != errNotWatched {
+			if err != ErrNotWatched {
 				return err
 			}
 			return nil
@@ -314,10 +345,9 @@ func (t *trg) dir(w *watched, n interface{}, e, ge Event) (evn []event) {
 		if ge&not2nat[Rename] != 0 {
 			for p := range t.pthLkp {
 				if strings.HasPrefix(p, w.p+string(os.PathSeparator)) {
-					if err := t.singleunwatch(p, both); err != nil && err != errNotWatched &&
+					if err := t.singleunwatch(p, both); err != nil && err != ErrNotWatched &&
 						!os.IsNotExist(err) {
-						dbgprintf("trg: failed stop watching moved file (%q): %q\n",
-							p, err)
+						debug("trg: failed stop watching moved file", "path", p, "err", err)
 					}
 					if (w.eDir|w.eNonDir)&(not2nat[Rename]|Rename) != 0 {
 						evn = append(evn, event{
@@ -337,9 +367,9 @@ func (t *trg) dir(w *watched, n interface{}, e, ge Event) (evn []event) {
 			switch err := t.singlewatch(p, w.eDir, ndir, fi); {
 			case os.IsNotExist(err) && ((w.eDir & Remove) != 0):
 				evn = append(evn, event{p, Remove, fi.IsDir(), n})
-			case err == errAlreadyWatched:
+			case err == ErrAlreadyWatched:
 			case err != nil:
-				dbgprintf("trg: watching %q failed: %q", p, err)
+				t.report(&WatchError{Op: "watch", Path: p, Err: err})
 			case (w.eDir & Create) != 0:
 				evn = append(evn, event{p, Create, fi.IsDir(), n})
 			default:
@@ -349,7 +379,7 @@ func (t *trg) dir(w *watched, n interface{}, e, ge Event) (evn []event) {
 		case os.IsNotExist(err):
 			return
 		case err != nil:
-			dbgprintf("trg: dir processing failed: %q", err)
+			t.report(&WatchError{Op: "read", Path: w.p, Err: err})
 		default:
 		}
 	}
@@ -368,7 +398,7 @@ const (
 func (t *trg) singleunwatch(p string, direct mode) error {
 	w, ok := t.pthLkp[p]
 	if !ok {
-		return errNotWatched
+		return ErrNotWatched
 	}
 	switch direct {
 	case dir:
@@ -387,7 +417,7 @@ func (t *trg) singleunwatch(p string, direct mode) error {
 			mod = ndir
 		}
 		if err := t.singlewatch(p, w.eNonDir|w.eDir, mod,
-			w.fi); err != nil && err != errAlreadyWatched {
+			w.fi); err != nil && err != ErrAlreadyWatched {
 			return err
 		}
 	} else {
@@ -408,8 +438,9 @@ func (t *trg) monitor() {
 			t.s <- struct{}{}
 			return
 		case err != nil:
-			dbgprintf("trg: failed to read events: %q\n", err)
+			t.report(&WatchError{Op: "wait", Err: err})
 		default:
+			t.reads.Add(1)
 			t.send(t.process(n))
 		}
 	}
@@ -421,7 +452,7 @@ func (t *trg) process(n interface{}) (evn []event) {
 	w, ge, err := t.t.Watched(n)
 	if err != nil {
 		t.Unlock()
-		dbgprintf("trg: %v event lookup failed: %q", Event(ge), err)
+		debug("trg: event lookup failed", "event", Event(ge), "err", err)
 		return
 	}
 
@@ -431,7 +462,7 @@ func (t *trg) process(n interface{}) (evn []event) {
 		case err != nil:
 		default:
 			if err = t.t.Watch(fi, w, encode(w.eDir|w.eNonDir, fi.IsDir())); err != nil {
-				dbgprintf("trg: %q is no longer watched: %q", w.p, err)
+				t.report(&WatchError{Op: "watch", Path: w.p, Err: err})
 				t.t.Del(w)
 			}
 		}
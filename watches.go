@@ -0,0 +1,148 @@
+// Copyright (c) 2014-2015 The Notify Authors. All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WatchInfo describes a single watched path.
+type WatchInfo struct {
+	// Path is the absolute, cleaned path of the watch. For recursive watches
+	// it does not contain the trailing "...".
+	Path string
+
+	// Events is the logical sum of events all the subscribers listen on.
+	Events Event
+
+	// Recursive reports whether any of the subscribers watches the path
+	// recursively.
+	Recursive bool
+
+	// Subscribers is the number of channels watching the path.
+	Subscribers int
+
+	// Kernel reports whether the path is backed by a watch of the underlying
+	// watcher. It is false for paths covered by a recursive watch of their
+	// parent, if the watcher watches the whole subtree with a single watch,
+	// e.g. FSEvents or ReadDirectoryChangesW.
+	Kernel bool
+}
+
+// String implements fmt.Stringer interface.
+func (wi WatchInfo) String() string {
+	s := wi.Path
+	if wi.Recursive {
+		s = filepath.Join(s, "...")
+	}
+	return fmt.Sprintf("%s: %v (subscribers=%d, kernel=%t)", s, wi.Events, wi.Subscribers, wi.Kernel)
+}
+
+// MarshalJSON implements json.Marshaler interface. It encodes Events as
+// a string, e.g. "notify.Create|notify.Write".
+func (wi WatchInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path        string `json:"path"`
+		Events      string `json:"events"`
+		Recursive   bool   `json:"recursive"`
+		Subscribers int    `json:"subscribers"`
+		Kernel      bool   `json:"kernel"`
+	}{wi.Path, wi.Events.String(), wi.Recursive, wi.Subscribers, wi.Kernel})
+}
+
+// WatchList is a list of watched paths, sorted by path.
+type WatchList []WatchInfo
+
+// String gives a human-readable dump of the list, one path per line.
+func (wl WatchList) String() string {
+	var b strings.Builder
+	for _, wi := range wl {
+		b.WriteString(wi.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// add appends to wl a user watchpoint on the path with the event set e. It
+// merges watchpoints on the same path, given one after another. The watched
+// function reports whether the path is backed by a watch of the watcher.
+func (wl WatchList) add(path string, e Event, watched func(string) bool) WatchList {
+	if n := len(wl); n != 0 && wl[n-1].Path == path {
+		wl[n-1].Events |= e &^ internal
+		wl[n-1].Recursive = wl[n-1].Recursive || e&recursive != 0
+		wl[n-1].Subscribers++
+		return wl
+	}
+	return append(wl, WatchInfo{
+		Path:        path,
+		Events:      e &^ internal,
+		Recursive:   e&recursive != 0,
+		Subscribers: 1,
+		Kernel:      watched(path),
+	})
+}
+
+func (wl WatchList) sort() WatchList {
+	sort.Slice(wl, func(i, j int) bool { return wl[i].Path < wl[j].Path })
+	return wl
+}
+
+// Watches gives the list of paths watched within the Notifier n. It gives nil
+// if n was closed.
+func (n *Notifier) Watches() WatchList {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return nil
+	}
+	return n.tree.Watches()
+}
+
+// Watches gives the list of watched paths. It is meant for debugging, e.g.
+// for finding leaked watches:
+//
+//	http.HandleFunc("/debug/notify", func(w http.ResponseWriter, r *http.Request) {
+//	    if r.URL.Query().Get("format") == "json" {
+//	        json.NewEncoder(w).Encode(notify.Watches())
+//	        return
+//	    }
+//	    io.WriteString(w, notify.Watches().String())
+//	})
+func Watches() WatchList {
+	return defaultNotifier.Watches()
+}
+
+// Watches gives the list of paths with user watchpoints.
+func (t *nonrecursiveTree) Watches() WatchList {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return watches(t.root.nd, t.sinks, t.cnt.watched)
+}
+
+// Watches gives the list of paths with user watchpoints.
+func (t *recursiveTree) Watches() WatchList {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return watches(t.root.nd, t.sinks, t.cnt.watched)
+}
+
+// watches gives the list of paths with user watchpoints within the tree rooted
+// at nd. Watchpoints of internal channels are skipped. The watched function
+// reports whether a path is backed by a watch of the watcher.
+func watches(nd node, s *sinks, watched func(string) bool) (wl WatchList) {
+	nd.Walk(func(nd node) error {
+		for c, e := range nd.Watch {
+			if c != nil && !s.IsInternal(c) {
+				wl = wl.add(nd.Name, e, watched)
+			}
+		}
+		return nil
+	})
+	return wl.sort()
+}
@@ -78,18 +78,34 @@ func (wp watchpoint) Del(c chan<- EventInfo, e Event) (diff eventDiff) {
 	return
 }
 
-func (wp watchpoint) Dispatch(ei EventInfo, extra Event) {
+// Dispatch appends to d every channel registered within the watchpoint, which
+// listens for the given event.
+func (wp watchpoint) Dispatch(ei EventInfo, extra Event, d *deliveries) {
 	e := eventmask(ei, extra)
+	if _, ok := ei.(*moved); ok {
+		// Moves, also the unpaired ones, are sent to Move listeners only.
+		e = Move | extra
+	}
 	if !matches(wp[nil], e) {
 		return
 	}
 	for ch, eset := range wp {
 		if ch != nil && matches(eset, e) {
-			select {
-			case ch <- ei:
-			default: // Drop event if receiver is too slow
-				dbgprintf("dropped %s on %q: receiver too slow", ei.Event(), ei.Path())
-			}
+			*d = append(*d, delivery{c: ch, ei: ei, internal: eset&omit != 0})
+		}
+	}
+}
+
+// DispatchOverflow appends to d an Overflow event for every user channel
+// registered within the watchpoint, regardless of its event set. The path of
+// the event is set to the given path of the watchpoint.
+func (wp watchpoint) DispatchOverflow(ei EventInfo, path string, d *deliveries) {
+	for ch, eset := range wp {
+		if ch != nil && eset&omit == 0 {
+			*d = append(*d, delivery{
+				c:  ch,
+				ei: &synthetic{e: Overflow, p: path, sys: ei.Sys()},
+			})
 		}
 	}
 }